@@ -9,6 +9,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-ini/ini"
@@ -35,98 +36,149 @@ func (e Enum) ConfEnum(value string, defaultVal int) int {
 	return defaultVal
 }
 
-func confValue(key string, s *ini.Section) string {
-	return s.Key(key).Value()
+// Name of enum value v, return false if v is not in enum
+func (e Enum) Name(v int) (string, bool) {
+	for name, ev := range e {
+		if ev == v {
+			return name, true
+		}
+	}
+
+	return "", false
 }
 
-func strToBoolean(value string) (bool, bool) {
-	if strings.ToLower(value) == "true" {
-		return true, true
-	} else if strings.ToLower(value) == "false" {
-		return false, true
+// Enums registered for enum tag, loglevel is registered as LoglvEnum
+var (
+	enums     = map[string]Enum{"loglevel": LoglvEnum}
+	enumsLock sync.Mutex
+)
+
+// Register enum e as name, integer field with tag enum:"name" is reflected
+// from name of enum value in config
+//
+//	golib.RegisterEnum("t", enumT)
+//
+//	type Config struct {
+//		CEnum int `enum:"t" default:"T2"`
+//	}
+func RegisterEnum(name string, e Enum) error {
+	enumsLock.Lock()
+	defer enumsLock.Unlock()
+
+	if _, ok := enums[name]; ok {
+		return fmt.Errorf("enum %s has been registered", name)
 	}
 
-	return false, false
+	enums[name] = e
+
+	return nil
 }
 
-func defaultBoolean(value string) bool {
-	ret, ok := strToBoolean(value)
+// Get enum registered as name
+func LookupEnum(name string) (Enum, bool) {
+	enumsLock.Lock()
+	defer enumsLock.Unlock()
 
-	if ok {
-		return ret
-	}
+	e, ok := enums[name]
 
-	return false
+	return e, ok
 }
 
-func confBoolean(value string, defaultVal bool) bool {
-	ret, ok := strToBoolean(value)
+// Convert enum value name str into integer value by enum registered as
+// name. Return false if str is empty, return error if str is not in enum
+func strToEnum(value reflect.Value, name string, str string) (bool, error) {
+	e, ok := LookupEnum(name)
+	if !ok {
+		return false, fmt.Errorf("enum %s not registered", name)
+	}
 
-	if ok {
-		return ret
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+	default:
+		return false, fmt.Errorf("enum %s for %s", name, value.Type())
 	}
 
-	return defaultVal
-}
+	if str == "" {
+		return false, nil
+	}
 
-func confString(value string, defaultVal string) string {
-	if value == "" {
-		return defaultVal
+	v, ok := e[str]
+	if !ok {
+		return false, fmt.Errorf("%s not in enum %s", str, name)
 	}
 
-	return value
-}
+	if value.OverflowInt(int64(v)) {
+		return false, rangeError(str, value.Type())
+	}
 
-func strToUint64(value string) (uint64, bool) {
-	ret, err := strconv.ParseUint(value, 10, 64)
+	value.SetInt(int64(v))
 
-	return ret, err == nil
+	return true, nil
 }
 
-func defaultUint64(value string) uint64 {
-	ret, ok := strToUint64(value)
+// Convert config value str into value of field, use enum if field has
+// enum tag
+func confToValue(field reflect.StructField, value reflect.Value,
+	str string) (bool, error) {
 
-	if ok {
-		return ret
+	if fe := field.Tag.Get("enum"); fe != "" {
+		return strToEnum(value, fe, str)
 	}
 
-	return 0
+	return strToValue(value, str)
 }
 
-func confUint64(value string, defaultVal uint64) uint64 {
-	ret, ok := strToUint64(value)
-
-	if ok {
-		return ret
+// Set value of field to default value in default tag, default of enum
+// field is name of enum value
+func confDefault(field reflect.StructField, value reflect.Value) error {
+	fe := field.Tag.Get("enum")
+	if fe == "" {
+		return setDefault(value, field.Tag.Get("default"))
 	}
 
-	return defaultVal
-}
+	ok, err := strToEnum(value, fe, field.Tag.Get("default"))
+	if err != nil {
+		return err
+	}
 
-func strToInt64(value string) (int64, bool) {
-	ret, err := strconv.ParseInt(value, 10, 64)
+	if !ok {
+		value.Set(reflect.Zero(value.Type()))
+	}
 
-	return ret, err == nil
+	return nil
 }
 
-func defaultInt64(value string) int64 {
-	ret, ok := strToInt64(value)
+// Separator of list values in config and default tag
+const listSep = ","
 
-	if ok {
-		return ret
+// Split comma separated values, empty values are dropped
+func splitList(str string) []string {
+	var list []string
+
+	for _, v := range strings.Split(str, listSep) {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
 	}
 
-	return 0
+	return list
 }
 
-func confInt64(value string, defaultVal int64) int64 {
-	ret, ok := strToInt64(value)
+// Types converted from string format instead of number
+var (
+	sizeType     = reflect.TypeOf(Size(0))
+	durationType = reflect.TypeOf(time.Duration(0))
+)
 
-	if ok {
-		return ret
+func strToBoolean(value string) (bool, bool) {
+	if strings.ToLower(value) == "true" {
+		return true, true
+	} else if strings.ToLower(value) == "false" {
+		return false, true
 	}
 
-	return defaultVal
+	return false, false
 }
 
 func strToSize(value string) (Size, bool) {
@@ -138,61 +190,210 @@ func strToSize(value string) (Size, bool) {
 	return ret, false
 }
 
-func defaultSize(value string) Size {
-	ret, ok := strToSize(value)
+func strToTimeDuration(value string) (time.Duration, bool) {
+	if value == "" {
+		return time.Duration(0), false
+	}
 
-	if ok {
-		return ret
+	ret, err := time.ParseDuration(value)
+	if err == nil {
+		return ret, true
 	}
 
-	return 0
+	return time.Duration(0), false
 }
 
-func confSize(value string, defaultVal Size) Size {
-	ret, ok := strToSize(value)
-
-	if ok {
-		return ret
+// Return true if type t could be converted from a config value, bool,
+// string, integer, float and types based on them are supported
+func isConfScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+
+		return true
 	}
 
-	return defaultVal
+	return false
 }
 
-func strToTimeDuration(value string) (time.Duration, bool) {
-	if value == "" {
-		return time.Duration(0), false
+// Return true if type t is struct or pointer to struct
+func isConfStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
 	}
 
-	ret, err := time.ParseDuration(value)
+	return t.Kind() == reflect.Struct
+}
+
+func rangeError(str string, t reflect.Type) error {
+	return fmt.Errorf("%s out of range of %s", str, t.String())
+}
+
+// Result of strconv parse, return error if value out of range of type t,
+// return false if str is malformed
+func parseResult(err error, str string, t reflect.Type) (bool, error) {
 	if err == nil {
-		return ret, true
+		return true, nil
 	}
 
-	return time.Duration(0), false
+	if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+		return false, rangeError(str, t)
+	}
+
+	return false, nil
 }
 
-func defaultTimeDuration(value string) time.Duration {
-	ret, ok := strToTimeDuration(value)
+// Convert config value str into value by kind of value, Size and Duration
+// are converted from their string format. Return false if str is malformed,
+// return error if str is out of range of value type
+func strToValue(value reflect.Value, str string) (bool, error) {
+	t := value.Type()
+
+	switch t {
+	case sizeType:
+		v, ok := strToSize(str)
+		if ok {
+			value.SetInt(int64(v))
+		}
+		return ok, nil
+	case durationType:
+		v, ok := strToTimeDuration(str)
+		if ok {
+			value.SetInt(int64(v))
+		}
+		return ok, nil
+	}
 
-	if ok {
-		return ret
+	switch t.Kind() {
+	case reflect.Bool:
+		v, ok := strToBoolean(str)
+		if ok {
+			value.SetBool(v)
+		}
+		return ok, nil
+	case reflect.String:
+		value.SetString(str)
+		return true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+
+		v, err := strconv.ParseInt(str, 10, t.Bits())
+		if err == nil {
+			value.SetInt(v)
+		}
+		return parseResult(err, str, t)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+
+		v, err := strconv.ParseUint(str, 10, t.Bits())
+		if err == nil {
+			value.SetUint(v)
+		}
+		return parseResult(err, str, t)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(str, t.Bits())
+		if err == nil {
+			value.SetFloat(v)
+		}
+		return parseResult(err, str, t)
 	}
 
-	return time.Duration(0)
+	return false, nil
 }
 
-func confTimeDuration(value string, defaultVal time.Duration) time.Duration {
-	ret, ok := strToTimeDuration(value)
+// Set value to default value in default tag fd, zero if fd is empty or
+// malformed
+func setDefault(value reflect.Value, fd string) error {
+	ok, err := strToValue(value, fd)
+	if err != nil {
+		return err
+	}
 
-	if ok {
-		return ret
+	if !ok {
+		value.Set(reflect.Zero(value.Type()))
 	}
 
-	return defaultVal
+	return nil
+}
+
+// Convert config values into slice of type t, return false if any value
+// is malformed
+func strsToSlice(t reflect.Type, strs []string) (reflect.Value, bool,
+	error) {
+
+	list := reflect.MakeSlice(t, len(strs), len(strs))
+
+	for i, str := range strs {
+		ok, err := strToValue(list.Index(i), str)
+		if !ok {
+			return reflect.Zero(t), false, err
+		}
+	}
+
+	return list, true, nil
+}
+
+// Default value for list in default tag fd
+func defaultSlice(t reflect.Type, fd string) (reflect.Value, error) {
+	list, ok, err := strsToSlice(t, splitList(fd))
+	if !ok || list.Len() == 0 {
+		return reflect.Zero(t), err
+	}
+
+	return list, nil
+}
+
+// Convert value into struct or pointer to struct of type t by decode
+func newConfStruct(t reflect.Type, decode func(v reflect.Value) error) (
+	reflect.Value, error) {
+
+	if t.Kind() == reflect.Ptr {
+		v := reflect.New(t.Elem())
+		return v, decode(v.Elem())
+	}
+
+	v := reflect.New(t).Elem()
+	return v, decode(v)
+}
+
+func unsupportedConf(secName string, fn string, t reflect.Type) error {
+	return fmt.Errorf(
+		"Unsuppoted config, secName: %s, name: %s, type: %s\n",
+		secName, fn, t.String())
 }
 
 // Reflect ini config into struct
 //
+// Fields could be validated by tags required, min, max, oneof and pattern,
+// all invalid keys are returned in *ConfigError, see validateConfig.
+//
+// With option ConfigStrict, keys and child sections of section secName not
+// mapped to any field, and values could not be converted into type of field
+// are also returned in *ConfigError. Otherwise they are ignored, and field
+// of malformed value is set to default value, unless the field has
+// validation tags. Values out of range of field and unknown enum names are
+// always returned in *ConfigError, and field is set to default value.
+//
+// Nested struct field is reflected from child section, such as field TLS of
+// struct reflected from section Server is reflected from section Server.TLS.
+// Fields of embedded struct are reflected from the same section as outer
+// struct. Pointer to struct is allocated only when its child section exists,
+// pointer to other types is allocated only when its key exists or it has
+// default value.
+//
+// Integer field with tag enum:"name" is reflected from name of value in enum
+// registered by RegisterEnum, default tag is also name of enum value.
+//
+// List field is reflected from comma separated values, or repeated keys
+// with one element in each value, map field is reflected from keys in
+// child section. List and map of struct are reflected from child sections
+// of child section, one section for each element, such as
+// [Server.Upstreams.a]
+//
 // Example:
 //
 // test.ini:
@@ -219,10 +420,12 @@ func confTimeDuration(value string, defaultVal time.Duration) time.Duration {
 //		CInt64    int64         `default:"-100"`
 //		CSize     golib.Size    `default:"10M"`
 //		CDuration time.Duration `default:"20s"`
-//		CEnum     string        `default:"T2"`
+//		CEnum     int           `enum:"t" default:"T2"`
 //	}
 //
 //	func main() {
+//		golib.RegisterEnum("t", enumT)
+//
 //		f, err := ini.Load("test.ini")
 //		if err != nil {
 //			fmt.Println("Load test.ini failed", err)
@@ -240,60 +443,96 @@ func confTimeDuration(value string, defaultVal time.Duration) time.Duration {
 //	}
 //
 // Result:
-//	&{true Hello World 100 -100 10M 20s T2}
-func Config(f *ini.File, secName string, it interface{}) error {
+//	&{true Hello World 100 -100 10M 20s 1}
+func Config(f *ini.File, secName string, it interface{},
+	opts ...ConfigOption) error {
+
 	if secName == "DEFAULT" {
 		secName = ""
 	}
 
-	s := f.Section(secName)
-
-	t := reflect.TypeOf(it).Elem()
-	v := reflect.ValueOf(it).Elem()
-	n := t.NumField()
-
-	for i := 0; i < n; i++ {
-		field := t.Field(i)
-		value := v.Field(i)
-		fn := field.Name
-		ft := field.Type.Name()
-		fd := field.Tag.Get("default")
-
-		switch ft {
-		case "bool":
-			confV := confValue(strings.ToLower(fn), s)
-			value.SetBool(confBoolean(confV, defaultBoolean(fd)))
-		case "string":
-			confV := confValue(strings.ToLower(fn), s)
-			value.SetString(confString(confV, fd))
-		case "uint64":
-			confV := confValue(strings.ToLower(fn), s)
-			value.SetUint(confUint64(confV, defaultUint64(fd)))
-		case "int64":
-			confV := confValue(strings.ToLower(fn), s)
-			value.SetInt(confInt64(confV, defaultInt64(fd)))
-		case "Size":
-			confV := confValue(strings.ToLower(fn), s)
-			value.SetInt(int64(confSize(confV, defaultSize(fd))))
-		case "Duration":
-			confV := confValue(strings.ToLower(fn), s)
-			value.SetInt(int64(confTimeDuration(confV,
-				defaultTimeDuration(fd))))
+	d, s := newIniTree(f, secName)
+
+	return decodeConfig(d, secName, s, it, opts...)
+}
+
+// Name of child section for nested struct field fn in section secName
+func childSection(secName string, fn string) string {
+	if secName == "" {
+		return fn
+	}
+
+	return secName + "." + fn
+}
+
+// Convert section secName and its child sections in ini file f into config
+// tree and its decoder. Key of section is value in tree, repeated key is an
+// array of its values. Child section is a tree in its parent, such as
+// section secName.TLS.a is tree of key a in tree of key TLS. If secName is
+// empty, all sections are children of DEFAULT
+func newIniTree(f *ini.File, secName string) (*treeDecoder,
+	map[string]interface{}) {
+
+	d := &treeDecoder{
+		namer: iniNamer,
+		ini:   true,
+		order: make(map[string]int),
+	}
+	tree := make(map[string]interface{})
+
+	prefix := secName + "."
+	if secName == "" {
+		prefix = ""
+	}
+
+	for i, sec := range f.Sections() {
+		name := sec.Name()
+		d.order[name] = i
+
+		node := tree
+		switch {
+		case name == secName ||
+			(secName == "" && name == ini.DEFAULT_SECTION):
+		case strings.HasPrefix(name, prefix):
+			for _, k := range strings.Split(name[len(prefix):], ".") {
+				child, ok := node[k].(map[string]interface{})
+				if !ok {
+					child = make(map[string]interface{})
+					node[k] = child
+				}
+				node = child
+			}
 		default:
-			return fmt.Errorf(
-				"Unsuppoted config, secName: %s, name: %s, type: %s\n",
-				secName, fn, ft)
+			continue
+		}
+
+		for _, k := range sec.Keys() {
+			values := k.ValueWithShadows()
+			if len(values) == 1 {
+				node[k.Name()] = values[0]
+				continue
+			}
+
+			arr := make([]interface{}, len(values))
+			for j, v := range values {
+				arr[j] = v
+			}
+			node[k.Name()] = arr
 		}
 	}
 
-	return nil
+	return d, tree
 }
 
-func ConfigFile(path string, secName string, it interface{}) error {
-	f, err := ini.Load(path)
+// Load ini file in path and reflect section secName into struct it, same
+// key could be repeated for list values
+func ConfigFile(path string, secName string, it interface{},
+	opts ...ConfigOption) error {
+
+	f, err := ini.LoadSources(ini.LoadOptions{AllowShadows: true}, path)
 	if err != nil {
 		return err
 	}
 
-	return Config(f, secName, it)
+	return Config(f, secName, it, opts...)
 }
@@ -180,3 +180,450 @@ func TestUnsupportedType(t *testing.T) {
 
 	t.Error("parse successd")
 }
+
+type TLSConfig struct {
+	Cert    string
+	Key     string        `default:"server.key"`
+	Timeout time.Duration `default:"5s"`
+}
+
+type UpstreamConfig struct {
+	Addr string
+}
+
+type BaseConfig struct {
+	Name string
+}
+
+type ServerConfig struct {
+	BaseConfig
+
+	Listen   int64
+	Backlog  *int64
+	Workers  *int64 `default:"4"`
+	TLS      TLSConfig
+	Upstream *UpstreamConfig
+	Cache    *UpstreamConfig
+}
+
+func TestNestedConfig(t *testing.T) {
+	config := &ServerConfig{}
+	err := golib.ConfigFile("test/test.ini", "Server", config)
+	if err != nil {
+		t.Error("Parse config failed:", err)
+		return
+	}
+
+	if config.Name != "server" || config.Listen != 8080 {
+		t.Error("server config failed, get:", config)
+	}
+
+	if config.Backlog != nil || config.Workers == nil ||
+		*config.Workers != 4 {
+
+		t.Error("pointer config failed, get:", config.Backlog, config.Workers)
+	}
+
+	if config.TLS.Cert != "server.crt" || config.TLS.Key != "server.key" ||
+		config.TLS.Timeout != 10*time.Second {
+
+		t.Error("tls config failed, get:", config.TLS)
+	}
+
+	if config.Upstream == nil || config.Upstream.Addr != "127.0.0.1:8081" {
+		t.Error("upstream config failed, get:", config.Upstream)
+	}
+
+	if config.Cache != nil {
+		t.Error("cache config failed, get:", config.Cache)
+	}
+
+	fmt.Println(config, config.TLS, config.Upstream)
+
+	fmt.Println("---------------------------------------------------")
+}
+
+type ListConfig struct {
+	Hosts     []string
+	Ports     []int64
+	Sizes     []golib.Size
+	Timeouts  []time.Duration
+	Bad       []int64  `default:"1,2"`
+	Default   []string `default:"x, y"`
+	Labels    map[string]string
+	Upstreams []UpstreamConfig
+	Backends  map[string]*UpstreamConfig
+}
+
+func checkListConfig(t *testing.T, config *ListConfig) {
+	expect := "[a.com b.com c.com] [80 443] [1K 2M] [1s 2m0s] [1 2] [x y]"
+	get := fmt.Sprint(config.Hosts, config.Ports, config.Sizes,
+		config.Timeouts, config.Bad, config.Default)
+	if get != expect {
+		t.Error("list config failed, expect:", expect, "get:", get)
+	}
+
+	if len(config.Labels) != 2 || config.Labels["env"] != "prod" ||
+		config.Labels["zone"] != "us" {
+
+		t.Error("map config failed, get:", config.Labels)
+	}
+
+	if len(config.Upstreams) != 2 ||
+		config.Upstreams[0].Addr != "127.0.0.1:8081" ||
+		config.Upstreams[1].Addr != "127.0.0.1:8082" {
+
+		t.Error("struct list config failed, get:", config.Upstreams)
+	}
+
+	if len(config.Backends) != 1 || config.Backends["b1"] == nil ||
+		config.Backends["b1"].Addr != "127.0.0.1:9001" {
+
+		t.Error("struct map config failed, get:", config.Backends)
+	}
+}
+
+func TestListConfig(t *testing.T) {
+	config := &ListConfig{}
+	err := golib.ConfigFile("test/test.ini", "List", config)
+	if err != nil {
+		t.Error("Parse config failed:", err)
+		return
+	}
+
+	checkListConfig(t, config)
+	fmt.Println(config)
+
+	err = golib.ConfigFile("test/test.ini", "List", &ListConfig{},
+		golib.ConfigStrict)
+	cerr, ok := err.(*golib.ConfigError)
+	if !ok || len(cerr.Errors) != 1 || cerr.Errors[0].Key != "bad" {
+		t.Error("Parse strict config failed, expect bad malformed, get:", err)
+	}
+
+	jconfig := &ListConfig{}
+	err = golib.JsonConfigFile("test/list.json", jconfig)
+	if err != nil {
+		t.Error("Parse json config failed:", err)
+		return
+	}
+
+	checkListConfig(t, jconfig)
+	fmt.Println(jconfig)
+
+	yconfig := &ListConfig{}
+	err = golib.YamlConfigFile("test/list.yaml", yconfig, golib.ConfigStrict)
+	if cerr, ok := err.(*golib.ConfigError); !ok || len(cerr.Errors) != 1 {
+		t.Error("Parse yaml config failed, expect bad malformed, get:", err)
+		return
+	}
+
+	checkListConfig(t, yconfig)
+
+	tconfig := &ListConfig{}
+	err = golib.TomlConfigFile("test/list.toml", tconfig)
+	if err != nil {
+		t.Error("Parse toml config failed:", err)
+		return
+	}
+
+	checkListConfig(t, tconfig)
+
+	fmt.Println("---------------------------------------------------")
+}
+
+type Port uint16
+
+type NumericConfig struct {
+	Int       int
+	Int8      int8
+	Uint16    uint16
+	Uint8     uint8
+	Float     float64
+	Port      Port
+	Ratio     float32
+	Malformed int32 `default:"3"`
+	Name      Name  `default:"numeric"`
+}
+
+type Name string
+
+type OverflowConfig struct {
+	Port Port
+}
+
+type IntegerConfig struct {
+	ID    int64
+	Max   uint64
+	Num   int
+	Ratio float64
+}
+
+func TestNumericConfig(t *testing.T) {
+	expect := "{-1 -128 65535 255 1.5 8080 0.25 3 numeric}"
+
+	config := &NumericConfig{}
+	err := golib.ConfigFile("test/test.ini", "Numeric", config)
+	if err != nil || fmt.Sprint(*config) != expect {
+		t.Error("numeric config failed, expect:", expect,
+			"get:", *config, err)
+	}
+
+	jconfig := &NumericConfig{}
+	err = golib.JsonConfigFile("test/numeric.json", jconfig)
+	if err != nil || fmt.Sprint(*jconfig) != expect {
+		t.Error("numeric json config failed, expect:", expect,
+			"get:", *jconfig, err)
+	}
+
+	err = golib.ConfigFile("test/test.ini", "Overflow", &OverflowConfig{})
+	fmt.Println(err)
+	if err == nil {
+		t.Error("overflow config successd")
+	}
+
+	err = golib.JsonConfig(`{"port": 70000}`, &OverflowConfig{})
+	fmt.Println(err)
+	if err == nil {
+		t.Error("overflow json config successd")
+	}
+
+	// integers in yaml and toml are exact
+	iexpect := "{9007199254740993 18446744073709551615 9223372036854775807 2}"
+
+	yconfig := &IntegerConfig{}
+	err = golib.YamlConfig("id: 9007199254740993\n"+
+		"max: 18446744073709551615\nnum: 9223372036854775807\nratio: 2\n",
+		yconfig, golib.ConfigStrict)
+	if err != nil || fmt.Sprint(*yconfig) != iexpect {
+		t.Error("integer yaml config failed, expect:", iexpect,
+			"get:", *yconfig, err)
+	}
+
+	tconfig := &IntegerConfig{}
+	err = golib.TomlConfig("id = 9007199254740993\n"+
+		"num = 9223372036854775807\nratio = 2\n", tconfig,
+		golib.ConfigStrict)
+	if err != nil || tconfig.ID != 9007199254740993 ||
+		tconfig.Num != 9223372036854775807 || tconfig.Ratio != 2 {
+
+		t.Error("integer toml config failed, get:", *tconfig, err)
+	}
+
+	err = golib.YamlConfig("port: 70000\n", &OverflowConfig{})
+	fmt.Println(err)
+	if err == nil {
+		t.Error("overflow yaml config successd")
+	}
+
+	fmt.Println("---------------------------------------------------")
+}
+
+type ValidateTLSConfig struct {
+	Cert string `required:"true"`
+}
+
+type ValidateConfig struct {
+	Level   string     `oneof:"debug info error" default:"info"`
+	Port    uint16     `min:"1" max:"65535"`
+	Name    string     `pattern:"^[a-z]+$"`
+	Tags    []string   `max:"2"`
+	Buffer  golib.Size `min:"1K" default:"512"`
+	Timeout int64      `required:"true"`
+	TLS     ValidateTLSConfig
+}
+
+func TestValidateConfig(t *testing.T) {
+	config := &ValidateConfig{}
+	err := golib.ConfigFile("test/test.ini", "Validate", config)
+	fmt.Println(err)
+
+	cerr, ok := err.(*golib.ConfigError)
+	if !ok {
+		t.Error("validate config failed, get:", err)
+		return
+	}
+
+	expect := []string{"level", "port", "name", "tags", "buffer", "timeout",
+		"cert"}
+	if len(cerr.Errors) != len(expect) {
+		t.Error("validate config failed, expect:", expect, "get:", err)
+		return
+	}
+
+	for i, e := range cerr.Errors {
+		if e.Key != expect[i] {
+			t.Error("validate config failed, expect:", expect[i],
+				"get:", e)
+		}
+	}
+
+	if cerr.Errors[6].Section != "Validate.TLS" {
+		t.Error("validate config section failed, get:", cerr.Errors[6])
+	}
+
+	err = golib.JsonConfig(`{"level": "debug", "port": 80, "name": "abc",
+		"timeout": 10, "tls": {"cert": "a.crt"}, "buffer": "1K"}`, config)
+	if err != nil {
+		t.Error("validate json config failed:", err)
+	}
+
+	fmt.Println("---------------------------------------------------")
+}
+
+type ConvertConfig struct {
+	Port    Port
+	Level   int `enum:"loglevel" default:"info"`
+	Workers int `min:"1" default:"4"`
+	Retry   int `default:"3"`
+	Ports   []uint16
+	Name    string `required:"true"`
+}
+
+func TestConvertConfig(t *testing.T) {
+	expect := []string{"port", "level", "workers", "ports", "name"}
+	values := "{0 1 4 3 [] }"
+
+	check := func(name string, err error, config *ConvertConfig) {
+		fmt.Println(err)
+
+		cerr, ok := err.(*golib.ConfigError)
+		if !ok || len(cerr.Errors) != len(expect) {
+			t.Error(name, "failed, expect:", expect, "get:", err)
+			return
+		}
+
+		for i, e := range cerr.Errors {
+			if e.Key != expect[i] {
+				t.Error(name, "failed, expect:", expect[i], "get:", e)
+			}
+		}
+
+		if fmt.Sprint(*config) != values {
+			t.Error(name, "failed, expect:", values, "get:", *config)
+		}
+	}
+
+	config := &ConvertConfig{}
+	err := golib.ConfigFile("test/test.ini", "Convert", config)
+	check("convert config", err, config)
+
+	config = &ConvertConfig{}
+	err = golib.JsonConfig(`{"port": 70000, "level": "loud",
+		"workers": "many", "retry": "x", "ports": [80, 70000]}`, config)
+	check("convert json config", err, config)
+
+	fmt.Println("---------------------------------------------------")
+}
+
+type StrictTLS struct {
+	Cert string
+}
+
+type StrictConfig struct {
+	Port    uint16
+	Timeout time.Duration `default:"1s"`
+	Tags    []string
+	TLS     StrictTLS
+}
+
+func TestStrictConfig(t *testing.T) {
+	config := &StrictConfig{}
+	err := golib.ConfigFile("test/test.ini", "Strict", config)
+	if err != nil || config.Timeout != time.Second {
+		t.Error("non strict config failed:", err, config)
+	}
+
+	err = golib.ConfigFile("test/test.ini", "Strict", config,
+		golib.ConfigStrict)
+	fmt.Println(err)
+
+	cerr, ok := err.(*golib.ConfigError)
+	if !ok {
+		t.Error("strict config failed, get:", err)
+		return
+	}
+
+	expect := []string{"Strict.timeout", "Strict.TLS.key", "Strict.prot",
+		"Strict.TSL."}
+	if len(cerr.Errors) != len(expect) {
+		t.Error("strict config failed, expect:", expect, "get:", err)
+		return
+	}
+
+	for i, e := range cerr.Errors {
+		if e.Section+"."+e.Key != expect[i] {
+			t.Error("strict config failed, expect:", expect[i], "get:", e)
+		}
+	}
+
+	err = golib.JsonConfig(`{"port": 80, "timeout": "1s", "tags": ["a"],
+		"tls": {"cert": "a.crt"}}`, config, golib.ConfigStrict)
+	if err != nil {
+		t.Error("strict json config failed:", err)
+	}
+
+	err = golib.JsonConfig(`{"port": "80", "prot": 80, "tags": ["a", 1],
+		"tls": {"cret": "a.crt"}}`, config, golib.ConfigStrict)
+	fmt.Println(err)
+
+	cerr, ok = err.(*golib.ConfigError)
+	if !ok || len(cerr.Errors) != 4 {
+		t.Error("strict json config failed, get:", err)
+	}
+
+	fmt.Println("---------------------------------------------------")
+}
+
+type EnumConfig struct {
+	Level int  `enum:"loglevel" default:"info"`
+	Mode  int8 `enum:"t" default:"T2"`
+	Def   int  `enum:"t" default:"T2"`
+	Ptr   *int `enum:"loglevel"`
+}
+
+func TestEnumConfig(t *testing.T) {
+	golib.RegisterEnum("t", enumT)
+	if err := golib.RegisterEnum("t", enumT); err == nil {
+		t.Error("register enum twice should fail")
+	}
+
+	config := &EnumConfig{}
+	err := golib.ConfigFile("test/test.ini", "Enum", config,
+		golib.ConfigStrict)
+	if err != nil {
+		t.Error("enum config failed:", err)
+	}
+
+	if config.Level != golib.LOGERROR || config.Mode != T3 ||
+		config.Def != T2 || config.Ptr != nil {
+
+		t.Error("enum config failed, get:", config)
+	}
+
+	if name, _ := golib.LoglvEnum.Name(config.Level); name != "error" {
+		t.Error("enum name failed, get:", name)
+	}
+
+	err = golib.ConfigFile("test/test.ini", "EnumUnknown", config)
+	fmt.Println(err)
+	if err == nil {
+		t.Error("unknown enum name should fail")
+	}
+
+	err = golib.JsonConfig(`{"level": "debug", "ptr": "fatal"}`, config,
+		golib.ConfigStrict)
+	if err != nil || config.Level != golib.LOGDEBUG || config.Mode != T2 ||
+		*config.Ptr != golib.LOGFATAL {
+
+		t.Error("enum json config failed:", err, config)
+	}
+
+	err = golib.JsonConfig(`{"mode": "T4"}`, config)
+	fmt.Println(err)
+	if err == nil {
+		t.Error("unknown json enum name should fail")
+	}
+
+	fmt.Println("---------------------------------------------------")
+}
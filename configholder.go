@@ -0,0 +1,182 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib config holder
+
+package golib
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Load config file in path into struct it, format is decided by extension
+// of path: .json, .yaml, .yml and .toml, otherwise INI, secName is the
+// section in INI file
+func loadConfigFile(path string, secName string, it interface{},
+	opts ...ConfigOption) error {
+
+	d, section, s, err := loadConfigTree(path, secName)
+	if err != nil {
+		return err
+	}
+
+	return decodeConfig(d, section, s, it, opts...)
+}
+
+// ConfigHolder holds config loaded from file, and reloads it as a
+// transactional reloader. Each load decodes file into a new struct, and
+// swaps it atomically if succeeded, so config got by Get is a consistent
+// snapshot and should not be modified. If load failed, the old config is
+// kept.
+//
+// Example:
+//
+//	h, err := golib.NewConfigHolder("app", "app.ini", "App", &AppConfig{})
+//	if err != nil {
+//		return err
+//	}
+//
+//	h.Subscribe(func(old interface{}, new interface{}) {
+//		fmt.Println("config changed", old, new)
+//	})
+//
+//	conf := h.Get().(*AppConfig)
+type ConfigHolder struct {
+	name    string
+	path    string
+	secName string
+	opts    []ConfigOption
+	typ     reflect.Type
+
+	value atomic.Value
+
+	pending interface{} // validated config, not committed
+	prev    interface{} // config before commit, for rollback
+	subs    []func(old interface{}, new interface{})
+	lock    sync.Mutex
+}
+
+// New a config holder, load config file in path into struct it, and
+// register it as reloader name. it must be a pointer to struct, it is the
+// first config got by Get, and each reload decodes into a new struct of
+// the same type. Format of file is decided by its extension: .json, .yaml,
+// .yml and .toml, otherwise INI, secName is the section in INI file
+func NewConfigHolder(name string, path string, secName string,
+	it interface{}, opts ...ConfigOption) (*ConfigHolder, error) {
+
+	if err := loadConfigFile(path, secName, it, opts...); err != nil {
+		return nil, err
+	}
+
+	h := &ConfigHolder{
+		name:    name,
+		path:    path,
+		secName: secName,
+		opts:    opts,
+		typ:     reflect.TypeOf(it).Elem(),
+	}
+	h.value.Store(it)
+
+	if err := AddTxReloader(name, h); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Get current config, type of config is the same as it in NewConfigHolder
+func (h *ConfigHolder) Get() interface{} {
+	return h.value.Load()
+}
+
+// Subscribe config changes, fn will be called with old and new config after
+// new config takes effect, or restored by rollback.
+//
+// fn is called synchronously in Commit and Rollback. When reloaded by
+// golib.Reload, it runs under the lock of reloaders, so fn must not call
+// functions managing reloaders, such as AddReloader, RemoveReloader,
+// ListReloaders, Reload and Close of holder, which deadlock. Call them in a
+// new goroutine if needed
+func (h *ConfigHolder) Subscribe(fn func(old interface{}, new interface{})) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.subs = append(h.subs, fn)
+}
+
+// Load config file into a new struct as pending config, current config is
+// not changed
+func (h *ConfigHolder) Validate() error {
+	h.lock.Lock()
+	h.pending, h.prev = nil, nil
+	h.lock.Unlock()
+
+	it := reflect.New(h.typ).Interface()
+	if err := loadConfigFile(h.path, h.secName, it, h.opts...); err != nil {
+		return err
+	}
+
+	h.lock.Lock()
+	h.pending = it
+	h.lock.Unlock()
+
+	return nil
+}
+
+// Swap pending config into current config and notify subscribers
+func (h *ConfigHolder) Commit() error {
+	h.lock.Lock()
+	if h.pending == nil {
+		h.lock.Unlock()
+		return nil
+	}
+
+	old, cur := h.value.Load(), h.pending
+	h.value.Store(cur)
+	h.prev, h.pending = old, nil
+	h.lock.Unlock()
+
+	h.notify(old, cur)
+
+	return nil
+}
+
+// Discard pending config, restore config before commit if committed
+func (h *ConfigHolder) Rollback() {
+	h.lock.Lock()
+	h.pending = nil
+	if h.prev == nil {
+		h.lock.Unlock()
+		return
+	}
+
+	cur, prev := h.value.Load(), h.prev
+	h.value.Store(prev)
+	h.prev = nil
+	h.lock.Unlock()
+
+	h.notify(cur, prev)
+}
+
+// Reload config file, keep current config if failed. Same as golib.Reload
+// with name of holder, so it could not run in middle of other reloads. Use
+// golib.Reload("") to reload with other reloaders in transaction
+func (h *ConfigHolder) Reload() error {
+	return Reload(h.name)
+}
+
+// Unregister config holder from reloaders, current config is kept
+func (h *ConfigHolder) Close() error {
+	return RemoveReloader(h.name)
+}
+
+func (h *ConfigHolder) notify(old interface{}, new interface{}) {
+	h.lock.Lock()
+	subs := append([]func(interface{}, interface{}){}, h.subs...)
+	h.lock.Unlock()
+
+	for _, fn := range subs {
+		fn(old, new)
+	}
+}
@@ -0,0 +1,105 @@
+package golib_test
+
+import (
+	"fmt"
+	"golib"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type failCommitReloader struct{}
+
+func (r *failCommitReloader) Validate() error {
+	return nil
+}
+
+func (r *failCommitReloader) Commit() error {
+	return fmt.Errorf("commit failed")
+}
+
+func (r *failCommitReloader) Rollback() {
+}
+
+type HolderConfig struct {
+	Port uint16 `min:"1"`
+	Name string `default:"app"`
+}
+
+func TestConfigHolder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golib_holder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.yaml")
+	ioutil.WriteFile(path, []byte("port: 80\n"), 0644)
+
+	name := fmt.Sprintf("TestConfigHolder%d", time.Now().UnixNano())
+	h, err := golib.NewConfigHolder(name, path, "", &HolderConfig{},
+		golib.ConfigStrict)
+	if err != nil {
+		t.Fatal("new config holder failed:", err)
+	}
+	defer h.Close()
+
+	e := &events{}
+	h.Subscribe(func(old interface{}, new interface{}) {
+		e.add("%d->%d", old.(*HolderConfig).Port, new.(*HolderConfig).Port)
+	})
+
+	first := h.Get().(*HolderConfig)
+	if first.Port != 80 || first.Name != "app" {
+		t.Error("load config failed, get:", first)
+	}
+
+	// successful reload swaps config
+	ioutil.WriteFile(path, []byte("port: 8080\n"), 0644)
+	if err := golib.Reload(name); err != nil {
+		t.Error("reload config failed:", err)
+	}
+
+	if first.Port != 80 || h.Get().(*HolderConfig).Port != 8080 {
+		t.Error("reload config failed, get:", first, h.Get())
+	}
+
+	// failed reload keeps old config
+	ioutil.WriteFile(path, []byte("port: 0\n"), 0644)
+	if err := golib.Reload(name); err == nil {
+		t.Error("reload invalid config should fail")
+	}
+
+	ioutil.WriteFile(path, []byte("prot: 81\n"), 0644)
+	if err := h.Reload(); err == nil {
+		t.Error("reload unknown key should fail in strict mode")
+	}
+
+	if h.Get().(*HolderConfig).Port != 8080 {
+		t.Error("failed reload should keep old config, get:", h.Get())
+	}
+
+	// committed config is restored if later reloader failed in transaction
+	ioutil.WriteFile(path, []byte("port: 9090\n"), 0644)
+
+	fname := name + "-fail"
+	golib.AddTxReloader(fname, &failCommitReloader{}, name)
+	defer golib.RemoveReloader(fname)
+
+	if err := golib.Reload(""); err == nil {
+		t.Error("reload with failed reloader should fail")
+	}
+
+	if h.Get().(*HolderConfig).Port != 8080 {
+		t.Error("rollback config failed, get:", h.Get())
+	}
+
+	expect := "80->8080,8080->9090,9090->8080"
+	if e.String() != expect {
+		t.Error("notify failed, expect:", expect, "get:", e.String())
+	}
+
+	fmt.Println("---------------------------------------------------")
+}
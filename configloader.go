@@ -0,0 +1,332 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib layered config loader
+
+package golib
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Layers of config loaded by ConfigLoader, later layer overrides earlier
+const (
+	ConfigLayerDefault = "default"
+	ConfigLayerFile    = "file"
+	ConfigLayerEnv     = "env"
+	ConfigLayerFlag    = "flag"
+)
+
+// Source of a config field value
+type ConfigSource struct {
+	// One of ConfigLayerDefault, ConfigLayerFile, ConfigLayerEnv and
+	// ConfigLayerFlag
+	Layer string
+
+	// File path, environment variable name or command line flag, empty
+	// for default
+	Name string
+}
+
+func (s ConfigSource) String() string {
+	if s.Name == "" {
+		return s.Layer
+	}
+
+	return s.Layer + " " + s.Name
+}
+
+// ConfigLoader loads config in layers: defaults from default tags, then
+// config file, then environment variables, then command line flags.
+//
+// Field is named by its path, keys from root struct to field joined by ".",
+// such as server.tls.cert. Key is lower case of field name in INI, json tag
+// or lower case of field name in JSON, YAML and TOML. Embedded struct is
+// flattened.
+//
+// Environment variable of field is env tag if set, otherwise upper case of
+// path prefixed by EnvPrefix, "." replaced by "_", such as
+// APP_SERVER_TLS_CERT. If EnvPrefix is empty, only env tag is used.
+//
+// Command line flag of field is --path=value, such as --server.tls.cert=a.
+//
+// Scalar, pointer to scalar and list of scalar could be overridden, list
+// is comma separated. Fields in nil pointer to struct, map and list of
+// struct could only be set in file.
+//
+// Example:
+//
+//	l := golib.NewConfigLoader("APP", os.Args[1:])
+//	if err := l.Load("app.ini", "App", config); err != nil {
+//		return err
+//	}
+//
+//	for path, src := range l.Sources() {
+//		fmt.Println(path, "from", src)
+//	}
+type ConfigLoader struct {
+	EnvPrefix string
+	Args      []string
+	Options   []ConfigOption
+
+	sources map[string]ConfigSource
+}
+
+// New a config loader with prefix of environment variables and command
+// line arguments, such as os.Args[1:]
+func NewConfigLoader(envPrefix string, args []string,
+	opts ...ConfigOption) *ConfigLoader {
+
+	return &ConfigLoader{
+		EnvPrefix: envPrefix,
+		Args:      args,
+		Options:   opts,
+	}
+}
+
+// Load config into struct it. Format of file in path is decided by its
+// extension: .json, .yaml, .yml and .toml, otherwise INI, secName is the
+// section in INI file. If path is empty, file layer is skipped.
+//
+// Values out of range in file, environment variables and flags, and
+// malformed values in environment variables and flags are errors. With
+// option ConfigStrict, flags not mapped to any field are errors. Fields are
+// validated after all layers loaded. All errors are returned in
+// *ConfigError
+func (l *ConfigLoader) Load(path string, secName string,
+	it interface{}) error {
+
+	d, secName, tree, err := loadConfigTree(path, secName)
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(it).Elem()
+	errs := &ConfigError{}
+	strict := hasConfigOption(l.Options, ConfigStrict)
+
+	if err := d.withErrors(errs, strict).decodeStruct(secName, tree,
+		v); err != nil {
+
+		return err
+	}
+
+	if strict {
+		d.strictStruct(secName, tree, v.Type(), errs)
+	}
+
+	// section relative to root of tree
+	relative := func(section string) string {
+		if secName == "" {
+			return section
+		}
+
+		return strings.TrimPrefix(strings.TrimPrefix(section, secName), ".")
+	}
+
+	flags := l.flags()
+	l.sources = make(map[string]ConfigSource)
+
+	walkConfig(secName, "", v, d.namer, func(section string, key string,
+		fp string, field reflect.StructField, value reflect.Value) {
+
+		src := ConfigSource{Layer: ConfigLayerDefault}
+		if d.exist(tree, relative(section), key) {
+			src = ConfigSource{Layer: ConfigLayerFile, Name: path}
+		}
+
+		if env := l.envName(fp, field); env != "" {
+			if str, ok := os.LookupEnv(env); ok {
+				s := ConfigSource{Layer: ConfigLayerEnv, Name: env}
+				if overrideConf(section, key, field, value, str, s,
+					errs) {
+
+					src = s
+				}
+			}
+		}
+
+		if str, ok := flags[fp]; ok {
+			delete(flags, fp)
+
+			s := ConfigSource{Layer: ConfigLayerFlag, Name: "--" + fp}
+			if overrideConf(section, key, field, value, str, s, errs) {
+				src = s
+			}
+		}
+
+		l.sources[fp] = src
+	})
+
+	if strict {
+		unknown := make([]string, 0, len(flags))
+		for path := range flags {
+			unknown = append(unknown, path)
+		}
+		sort.Strings(unknown)
+
+		for _, path := range unknown {
+			errs.add(secName, "--"+path, "unknown flag")
+		}
+	}
+
+	validateConfig(secName, v, d.namer, errs)
+
+	return errs.errorOrNil()
+}
+
+// Sources of fields in last Load, key is path of field
+func (l *ConfigLoader) Sources() map[string]ConfigSource {
+	return l.sources
+}
+
+// Source of field in path in last Load
+func (l *ConfigLoader) Source(path string) (ConfigSource, bool) {
+	src, ok := l.sources[path]
+
+	return src, ok
+}
+
+// Command line flags in form --path=value, last one is used if repeated
+func (l *ConfigLoader) flags() map[string]string {
+	flags := make(map[string]string)
+
+	for _, arg := range l.Args {
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+
+		kv := strings.SplitN(arg[2:], "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+
+		flags[kv[0]] = kv[1]
+	}
+
+	return flags
+}
+
+// Environment variable name of field in path
+func (l *ConfigLoader) envName(path string, field reflect.StructField) string {
+	if env := field.Tag.Get("env"); env != "" {
+		return env
+	}
+
+	if l.EnvPrefix == "" {
+		return ""
+	}
+
+	name := strings.ToUpper(strings.Replace(path, ".", "_", -1))
+
+	return l.EnvPrefix + "_" + name
+}
+
+// Walk fields of struct v could be overridden, section and key of field are
+// named by namer, path is keys from root struct joined by "."
+func walkConfig(section string, path string, v reflect.Value,
+	namer confNamer, fn func(section string, key string, path string,
+		field reflect.StructField, value reflect.Value)) {
+
+	t := v.Type()
+	n := t.NumField()
+
+	for i := 0; i < n; i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		if field.PkgPath != "" && !field.Anonymous { // unexported
+			continue
+		}
+
+		key, child := namer(section, field)
+
+		fp := key
+		if path != "" {
+			fp = path + "." + key
+		}
+
+		if isConfStruct(value.Type()) {
+			if value.Kind() == reflect.Ptr {
+				if value.IsNil() {
+					continue
+				}
+
+				value = value.Elem()
+			}
+
+			if field.Anonymous {
+				walkConfig(section, path, value, namer, fn)
+			} else {
+				walkConfig(child, fp, value, namer, fn)
+			}
+
+			continue
+		}
+
+		et := value.Type()
+		switch et.Kind() {
+		case reflect.Ptr, reflect.Slice:
+			et = et.Elem()
+		}
+
+		if !isConfScalar(et) || !value.CanSet() {
+			continue
+		}
+
+		fn(section, key, fp, field, value)
+	}
+}
+
+// Override value of field by str from src, return false if str is
+// malformed or out of range
+func overrideConf(section string, key string, field reflect.StructField,
+	value reflect.Value, str string, src ConfigSource,
+	errs *ConfigError) bool {
+
+	t := value.Type()
+
+	if t.Kind() == reflect.Slice {
+		list, ok, err := strsToSlice(t, splitList(str))
+		if err != nil {
+			errs.add(section, key, "%s in %s", err.Error(), src)
+			return false
+		}
+
+		if !ok {
+			errs.add(section, key, "malformed value %s in %s", str, src)
+			return false
+		}
+
+		value.Set(list)
+
+		return true
+	}
+
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	nv := reflect.New(t)
+
+	ok, err := confToValue(field, nv.Elem(), str)
+	if err != nil {
+		errs.add(section, key, "%s in %s", err.Error(), src)
+		return false
+	}
+
+	if !ok {
+		errs.add(section, key, "malformed value %s in %s", str, src)
+		return false
+	}
+
+	if value.Kind() == reflect.Ptr {
+		value.Set(nv)
+	} else {
+		value.Set(nv.Elem())
+	}
+
+	return true
+}
@@ -0,0 +1,85 @@
+package golib_test
+
+import (
+	"fmt"
+	"golib"
+	"os"
+	"testing"
+)
+
+func checkSource(t *testing.T, l *golib.ConfigLoader, path string,
+	expect string) {
+
+	src, ok := l.Source(path)
+	if !ok || src.String() != expect {
+		t.Error("source of", path, "expect:", expect, "get:", src)
+	}
+}
+
+func TestConfigLoader(t *testing.T) {
+	os.Setenv("TESTAPP_LISTEN", "9090")
+	os.Setenv("TESTAPP_TLS_CERT", "env.crt")
+	defer os.Unsetenv("TESTAPP_LISTEN")
+	defer os.Unsetenv("TESTAPP_TLS_CERT")
+
+	args := []string{"-v", "--tls.cert=flag.crt", "--backlog=128",
+		"--unknown=1"}
+	l := golib.NewConfigLoader("TESTAPP", args)
+
+	config := &ServerConfig{}
+	if err := l.Load("test/test.ini", "Server", config); err != nil {
+		t.Error("load config failed:", err)
+		return
+	}
+
+	if config.Name != "server" || config.Listen != 9090 ||
+		config.TLS.Cert != "flag.crt" || config.TLS.Key != "server.key" ||
+		config.Backlog == nil || *config.Backlog != 128 {
+
+		t.Error("load config failed, get:", config)
+	}
+
+	checkSource(t, l, "name", "file test/test.ini")
+	checkSource(t, l, "listen", "env TESTAPP_LISTEN")
+	checkSource(t, l, "tls.cert", "flag --tls.cert")
+	checkSource(t, l, "tls.key", "default")
+	checkSource(t, l, "upstream.addr", "file test/test.ini")
+
+	if _, ok := l.Source("cache.addr"); ok {
+		t.Error("field in nil pointer should not be loaded")
+	}
+
+	// unknown flag and malformed env in strict mode
+	os.Setenv("TESTAPP_WORKERS", "four")
+	defer os.Unsetenv("TESTAPP_WORKERS")
+
+	l = golib.NewConfigLoader("TESTAPP", args, golib.ConfigStrict)
+	err := l.Load("test/test.ini", "Server", &ServerConfig{})
+	fmt.Println(err)
+
+	cerr, ok := err.(*golib.ConfigError)
+	if !ok || len(cerr.Errors) != 2 {
+		t.Error("strict load config failed, get:", err)
+	}
+
+	// json file
+	os.Setenv("TESTAPP_CUINT64", "200")
+	defer os.Unsetenv("TESTAPP_CUINT64")
+
+	l = golib.NewConfigLoader("TESTAPP", []string{"--cstring=flag"})
+	jconfig := &JUnConfig{}
+	if err := l.Load("test/config.json", "", jconfig); err != nil {
+		t.Error("load json config failed:", err)
+	}
+
+	if jconfig.CString != "flag" || jconfig.CUint64 != 200 ||
+		jconfig.CInt64 != -100 {
+
+		t.Error("load json config failed, get:", jconfig)
+	}
+
+	checkSource(t, l, "cint64", "file test/config.json")
+	checkSource(t, l, "cuint64", "env TESTAPP_CUINT64")
+
+	fmt.Println("---------------------------------------------------")
+}
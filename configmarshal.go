@@ -0,0 +1,558 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib config marshal
+
+package golib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ini/ini"
+)
+
+// Marshal struct it into ini config, fields are written into section
+// secName and its child sections in the same layout as Config reflects
+// them. Size and Duration are written in their string format, enum field is
+// written as name of enum value, list is written as repeated key with one
+// element in each value. Nil pointer, empty list and empty map are omitted.
+//
+// Example:
+//
+//	data, err := golib.MarshalConfig("Server", config)
+//	if err != nil {
+//		return err
+//	}
+//
+//	os.Stdout.Write(data)
+func MarshalConfig(secName string, it interface{}) ([]byte, error) {
+	return marshalIni(secName, reflect.Indirect(reflect.ValueOf(it)), false)
+}
+
+// Generate a sample ini config of struct it, value of key is default value
+// in default tag, desc tag of field is written as comment of key. All child
+// sections are written, including those of nil pointer to struct, nil
+// pointer to other types without default value is omitted. Section of list
+// or map of struct is written with a comment on how to name its elements.
+//
+// Example:
+//
+//	type Config struct {
+//		Listen  uint16        `default:"8080" desc:"listen port"`
+//		Timeout time.Duration `default:"5s" desc:"read timeout"`
+//	}
+//
+//	data, err := golib.SampleConfig("Server", &Config{})
+//
+// Result:
+//
+//	[Server]
+//	; listen port
+//	listen  = 8080
+//	; read timeout
+//	timeout = 5s
+func SampleConfig(secName string, it interface{}) ([]byte, error) {
+	t := reflect.TypeOf(it)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if secName == "DEFAULT" {
+		secName = ""
+	}
+
+	v := reflect.New(t).Elem()
+	if err := confDefaults(secName, v); err != nil {
+		return nil, err
+	}
+
+	return marshalIni(secName, v, true)
+}
+
+// Marshal struct it into json config, key of field is json tag if set,
+// otherwise lower case of field name. Values are written in the same format
+// as MarshalConfig, number is written as json number
+func MarshalJsonConfig(it interface{}) ([]byte, error) {
+	m, err := marshalJsonStruct(reflect.Indirect(reflect.ValueOf(it)))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(m, "", "    ")
+}
+
+func marshalIni(secName string, v reflect.Value, sample bool) ([]byte,
+	error) {
+
+	if secName == "DEFAULT" {
+		secName = ""
+	}
+
+	f, err := ini.LoadSources(ini.LoadOptions{AllowShadows: true}, []byte(""))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := marshalSection(f, secName, v, sample); err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if _, err := f.WriteTo(buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Config string of scalar value, enum field is converted into name of enum
+// value
+func confString(field reflect.StructField, value reflect.Value) string {
+	if fe := field.Tag.Get("enum"); fe != "" {
+		if e, ok := LookupEnum(fe); ok {
+			if name, ok := e.Name(int(value.Int())); ok {
+				return name
+			}
+		}
+	}
+
+	switch value.Type() {
+	case sizeType:
+		return Size(value.Int()).String()
+	case durationType:
+		return time.Duration(value.Int()).String()
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool())
+	case reflect.String:
+		return value.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+
+		return strconv.FormatInt(value.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+
+		return strconv.FormatUint(value.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'g', -1,
+			value.Type().Bits())
+	}
+
+	return ""
+}
+
+// Config strings of list values
+func confStrings(field reflect.StructField, value reflect.Value) []string {
+	strs := make([]string, 0, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		strs = append(strs, confString(field, value.Index(i)))
+	}
+
+	return strs
+}
+
+// Keys of map with string key, sorted
+func sortedKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+
+	return keys
+}
+
+// Marshal struct v into section secName of f, in sample mode, comment of
+// key is desc tag, and nil pointer is written by marshalNil
+func marshalSection(f *ini.File, secName string, v reflect.Value,
+	sample bool) error {
+
+	name := secName
+	if name == "" {
+		name = ini.DEFAULT_SECTION
+	}
+
+	s, err := f.NewSection(name)
+	if err != nil {
+		return err
+	}
+
+	t := v.Type()
+	n := t.NumField()
+
+	for i := 0; i < n; i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		if field.PkgPath != "" && !field.Anonymous { // unexported
+			continue
+		}
+
+		if err := marshalField(f, s, secName, field, value,
+			sample); err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func marshalField(f *ini.File, s *ini.Section, secName string,
+	field reflect.StructField, value reflect.Value, sample bool) error {
+
+	fn := field.Name
+	desc := field.Tag.Get("desc")
+	child := childSection(secName, fn)
+
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			if !sample {
+				return nil
+			}
+
+			return marshalNil(f, s, secName, field, value.Type().Elem())
+		}
+
+		value = value.Elem()
+	}
+
+	t := value.Type()
+
+	switch value.Kind() {
+	case reflect.Struct:
+		if field.Anonymous {
+			return marshalSection(f, secName, value, sample)
+		}
+
+		if err := marshalSection(f, child, value, sample); err != nil {
+			return err
+		}
+
+		if sample && desc != "" {
+			f.Section(child).Comment = desc
+		}
+
+		return nil
+
+	case reflect.Slice, reflect.Map:
+		if t.Kind() == reflect.Map && t.Key().Kind() != reflect.String {
+			return unsupportedConf(secName, fn, t)
+		}
+
+		et := t.Elem()
+
+		if isConfStruct(et) {
+			return marshalElems(f, child, field, value, sample)
+		}
+
+		if !isConfScalar(et) {
+			return unsupportedConf(secName, fn, t)
+		}
+
+		if t.Kind() == reflect.Map {
+			return marshalMap(f, child, field, value, sample)
+		}
+
+		if value.Len() == 0 && !sample {
+			return nil
+		}
+
+		if sample {
+			key, err := s.NewKey(strings.ToLower(fn),
+				strings.Join(confStrings(field, value), listSep+" "))
+			if err != nil {
+				return err
+			}
+
+			key.Comment = desc
+
+			return nil
+		}
+
+		return marshalList(s, strings.ToLower(fn), confStrings(field, value))
+	}
+
+	if !isConfScalar(t) {
+		return unsupportedConf(secName, fn, t)
+	}
+
+	key, err := s.NewKey(strings.ToLower(fn), confString(field, value))
+	if err != nil {
+		return err
+	}
+
+	if sample {
+		key.Comment = desc
+	}
+
+	return nil
+}
+
+// Marshal nil pointer to type t in sample mode, struct is written with its
+// default values. Pointer to other type is omitted, as any key of it, even
+// empty, allocates it in Config
+func marshalNil(f *ini.File, s *ini.Section, secName string,
+	field reflect.StructField, t reflect.Type) error {
+
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	child := childSection(secName, field.Name)
+	if field.Anonymous {
+		child = secName
+	}
+
+	v := reflect.New(t).Elem()
+	if err := confDefaults(child, v); err != nil {
+		return err
+	}
+
+	return marshalField(f, s, secName, field, v, true)
+}
+
+// Marshal list values strs as repeated key, one element in each value. An
+// empty value is added to single value with comma, so it is not split
+func marshalList(s *ini.Section, name string, strs []string) error {
+	if len(strs) == 1 && strings.Contains(strs[0], listSep) {
+		strs = append(strs, "")
+	}
+
+	key, err := s.NewKey(name, strs[0])
+	if err != nil {
+		return err
+	}
+
+	for _, str := range strs[1:] {
+		if err := key.AddShadow(str); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Marshal map of scalar into section secName, one key for each element
+func marshalMap(f *ini.File, secName string, field reflect.StructField,
+	value reflect.Value, sample bool) error {
+
+	if value.Len() == 0 && !sample {
+		return nil
+	}
+
+	s, err := f.NewSection(secName)
+	if err != nil {
+		return err
+	}
+
+	if sample {
+		s.Comment = field.Tag.Get("desc")
+	}
+
+	for _, k := range sortedKeys(value) {
+		_, err := s.NewKey(k.String(), confString(field, value.MapIndex(k)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Marshal list or map of struct into child sections of section secName,
+// element of list is named by its index
+func marshalElems(f *ini.File, secName string, field reflect.StructField,
+	value reflect.Value, sample bool) error {
+
+	if sample {
+		s, err := f.NewSection(secName)
+		if err != nil {
+			return err
+		}
+
+		s.Comment = fmt.Sprintf("elements in sections [%s.<name>]",
+			secName)
+		if desc := field.Tag.Get("desc"); desc != "" {
+			s.Comment = desc + ini.LineBreak + s.Comment
+		}
+
+		return nil
+	}
+
+	marshalElem := func(name string, elem reflect.Value) error {
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				return nil
+			}
+
+			elem = elem.Elem()
+		}
+
+		return marshalSection(f, childSection(secName, name), elem, false)
+	}
+
+	if value.Kind() == reflect.Slice {
+		for i := 0; i < value.Len(); i++ {
+			if err := marshalElem(strconv.Itoa(i),
+				value.Index(i)); err != nil {
+
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, k := range sortedKeys(value) {
+		if err := marshalElem(k.String(), value.MapIndex(k)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Marshal struct v into json map
+func marshalJsonStruct(v reflect.Value) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+
+	if err := marshalJsonFields(m, v); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func marshalJsonFields(m map[string]interface{}, v reflect.Value) error {
+	t := v.Type()
+	n := t.NumField()
+
+	for i := 0; i < n; i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		if field.PkgPath != "" && !field.Anonymous { // unexported
+			continue
+		}
+
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				continue
+			}
+
+			value = value.Elem()
+		}
+
+		if field.Anonymous && value.Kind() == reflect.Struct {
+			if err := marshalJsonFields(m, value); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		fn := jsonKey(field)
+
+		jv, err := marshalJsonValue(field, value)
+		if err != nil {
+			return err
+		}
+
+		if jv != nil {
+			m[fn] = jv
+		}
+	}
+
+	return nil
+}
+
+// Marshal value of field into json value, return nil if value is omitted
+func marshalJsonValue(field reflect.StructField, value reflect.Value) (
+	interface{}, error) {
+
+	t := value.Type()
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			return nil, nil
+		}
+
+		return marshalJsonValue(field, value.Elem())
+
+	case reflect.Struct:
+		return marshalJsonStruct(value)
+
+	case reflect.Slice:
+		if value.Len() == 0 {
+			return nil, nil
+		}
+
+		arr := make([]interface{}, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			elem, err := marshalJsonValue(field, value.Index(i))
+			if err != nil {
+				return nil, err
+			}
+
+			arr = append(arr, elem)
+		}
+
+		return arr, nil
+
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, unsupportedJsonConf(jsonKey(field), t)
+		}
+
+		if value.Len() == 0 {
+			return nil, nil
+		}
+
+		obj := make(map[string]interface{}, value.Len())
+		for _, k := range value.MapKeys() {
+			elem, err := marshalJsonValue(field, value.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+
+			obj[k.String()] = elem
+		}
+
+		return obj, nil
+	}
+
+	if !isConfScalar(t) {
+		return nil, unsupportedJsonConf(jsonKey(field), t)
+	}
+
+	if t == sizeType || t == durationType || field.Tag.Get("enum") != "" {
+		return confString(field, value), nil
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		return value.Bool(), nil
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+
+		return value.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+
+		return value.Uint(), nil
+	}
+
+	return value.Float(), nil
+}
@@ -0,0 +1,152 @@
+package golib_test
+
+import (
+	"fmt"
+	"golib"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ini/ini"
+)
+
+type MarshalListConfig struct {
+	Size  golib.Size
+	Sizes []golib.Size
+	Hosts []string
+	One   []string
+}
+
+func TestMarshalConfig(t *testing.T) {
+	config := &ListConfig{}
+	if err := golib.ConfigFile("test/test.ini", "List", config); err != nil {
+		t.Error("Parse config failed:", err)
+		return
+	}
+
+	data, err := golib.MarshalConfig("List", config)
+	if err != nil {
+		t.Error("marshal config failed:", err)
+		return
+	}
+	fmt.Println(string(data))
+
+	f, err := ini.LoadSources(ini.LoadOptions{AllowShadows: true}, data)
+	if err != nil {
+		t.Error("load marshalled config failed:", err)
+		return
+	}
+
+	iconfig := &ListConfig{}
+	if err := golib.Config(f, "List", iconfig,
+		golib.ConfigStrict); err != nil {
+
+		t.Error("parse marshalled config failed:", err)
+	}
+
+	if !reflect.DeepEqual(config, iconfig) {
+		t.Error("marshal config failed, expect:", config, "get:", iconfig)
+	}
+
+	data, err = golib.MarshalJsonConfig(config)
+	if err != nil {
+		t.Error("marshal json config failed:", err)
+		return
+	}
+	fmt.Println(string(data))
+
+	jconfig := &ListConfig{}
+	err = golib.JsonConfig(string(data), jconfig, golib.ConfigStrict)
+	if err != nil {
+		t.Error("parse marshalled json config failed:", err)
+	}
+
+	if !reflect.DeepEqual(config, jconfig) {
+		t.Error("marshal json config failed, expect:", config,
+			"get:", jconfig)
+	}
+
+	// zero size and list elements with comma
+	lconfig := &MarshalListConfig{
+		Sizes: []golib.Size{0, golib.KByte},
+		Hosts: []string{"x,y", "z"},
+		One:   []string{"a,b"},
+	}
+
+	data, err = golib.MarshalConfig("List", lconfig)
+	if err != nil {
+		t.Error("marshal config failed:", err)
+		return
+	}
+	fmt.Println(string(data))
+
+	f, err = ini.LoadSources(ini.LoadOptions{AllowShadows: true}, data)
+	if err != nil {
+		t.Error("load marshalled config failed:", err)
+		return
+	}
+
+	liconfig := &MarshalListConfig{}
+	if err := golib.Config(f, "List", liconfig,
+		golib.ConfigStrict); err != nil {
+
+		t.Error("parse marshalled config failed:", err)
+	}
+
+	if !reflect.DeepEqual(lconfig, liconfig) {
+		t.Error("marshal list failed, expect:", lconfig, "get:", liconfig)
+	}
+
+	fmt.Println("---------------------------------------------------")
+}
+
+type SampleTLS struct {
+	Cert string `desc:"certificate file"`
+}
+
+type SampleConfig struct {
+	Listen  uint16        `default:"8080" desc:"listen port"`
+	Timeout time.Duration `default:"5s" desc:"read timeout"`
+	Level   int           `enum:"loglevel" default:"error"`
+	Hosts   []string      `default:"a, b"`
+	Backlog *int
+	Buffer  golib.Size `desc:"read buffer"`
+	TLS     *SampleTLS `desc:"tls config"`
+	Routes  map[string]UpstreamConfig
+}
+
+func TestSampleConfig(t *testing.T) {
+	data, err := golib.SampleConfig("Server", &SampleConfig{})
+	if err != nil {
+		t.Error("sample config failed:", err)
+		return
+	}
+
+	sample := string(data)
+	fmt.Println(sample)
+
+	for _, line := range []string{"; listen port", "8080", "5s", "error",
+		"a, b", "0B", "[Server.TLS]", "; certificate file", "[Server.Routes]"} {
+
+		if !strings.Contains(sample, line) {
+			t.Error("sample config missing:", line)
+		}
+	}
+
+	f, err := ini.Load(data)
+	if err != nil {
+		t.Error("load sample config failed:", err)
+		return
+	}
+
+	config := &SampleConfig{}
+	err = golib.Config(f, "Server", config, golib.ConfigStrict)
+	if err != nil || config.Listen != 8080 || config.Timeout != 5*time.Second ||
+		config.Level != golib.LOGERROR || config.Backlog != nil {
+
+		t.Error("parse sample config failed:", err, config)
+	}
+
+	fmt.Println("---------------------------------------------------")
+}
@@ -0,0 +1,211 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib config strict mode
+
+package golib
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Option of config loading
+type ConfigOption int
+
+const (
+	// Keys and sections in config not mapped to any field, and values
+	// could not be converted into type of field are returned as errors,
+	// instead of being ignored or replaced by default value
+	ConfigStrict ConfigOption = 1 << iota
+)
+
+func hasConfigOption(opts []ConfigOption, o ConfigOption) bool {
+	for _, opt := range opts {
+		if opt&o != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Type of field for strict check, pointer to struct or scalar is
+// dereferenced
+func strictType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+
+	return t
+}
+
+func malformedConf(section string, key string, str interface{},
+	t reflect.Type, errs *ConfigError) {
+
+	errs.add(section, key, "malformed value %v for %s", str, t.String())
+}
+
+// Check tree m of section reflected into struct type t, unknown keys and
+// malformed values are added into errs. In ini, unknown child sections are
+// reported after unknown keys
+func (d *treeDecoder) strictStruct(section string, m map[string]interface{},
+	t reflect.Type, errs *ConfigError) {
+
+	known := make(map[string]bool)
+	d.strictFields(section, m, t, known, errs)
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sections []string
+	for _, k := range keys {
+		if known[k] {
+			continue
+		}
+
+		if _, ok := m[k].(map[string]interface{}); ok && d.ini {
+			sections = append(sections, k)
+			continue
+		}
+
+		errs.add(section, k, "unknown key")
+	}
+
+	if section == "" { // all ini sections are children of DEFAULT
+		return
+	}
+
+	for _, k := range sections {
+		errs.add(childSection(section, k), "", "unknown section")
+	}
+}
+
+// Check fields of struct type t in tree m, keys of fields are recorded in
+// known, embedded struct is checked in the same tree
+func (d *treeDecoder) strictFields(section string, m map[string]interface{},
+	t reflect.Type, known map[string]bool, errs *ConfigError) {
+
+	n := t.NumField()
+
+	for i := 0; i < n; i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous { // unexported
+			continue
+		}
+
+		ft := strictType(field.Type)
+		if field.Anonymous && ft.Kind() == reflect.Struct {
+			d.strictFields(section, m, ft, known, errs)
+			continue
+		}
+
+		key, child := d.fieldKey(section, field)
+		known[key] = true
+
+		v, ok := m[key]
+		if !ok {
+			continue
+		}
+
+		if field.Tag.Get("enum") != "" { // name is checked in reflecting
+			if _, ok := v.(string); !ok && !d.ini {
+				malformedConf(section, key, v, ft, errs)
+			}
+			continue
+		}
+
+		d.strictValue(section, key, child, ft, v, errs)
+	}
+}
+
+// Check tree value v of key in section could be converted into type t,
+// child is section of v if v is a struct, list or map
+func (d *treeDecoder) strictValue(section string, key string, child string,
+	t reflect.Type, v interface{}, errs *ConfigError) {
+
+	t = strictType(t)
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			malformedConf(section, key, v, t, errs)
+			return
+		}
+
+		d.strictStruct(child, obj, t, errs)
+
+	case reflect.Slice:
+		if d.ini && isConfStruct(t.Elem()) { // sections of elements
+			d.strictValue(section, key, child,
+				reflect.MapOf(reflect.TypeOf(""), t.Elem()), v, errs)
+			return
+		}
+
+		if d.ini {
+			for _, str := range iniValues(v) {
+				d.strictValue(section, key, child, t.Elem(), str, errs)
+			}
+			return
+		}
+
+		arr, ok := v.([]interface{})
+		if !ok {
+			malformedConf(section, key, v, t, errs)
+			return
+		}
+
+		for i, elem := range arr {
+			d.strictValue(section, key, fmt.Sprintf("%s[%d]", child, i),
+				t.Elem(), elem, errs)
+		}
+
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			malformedConf(section, key, v, t, errs)
+			return
+		}
+
+		for _, k := range d.keys(child, obj) {
+			// element of ini map is a key or section in section child
+			if d.ini {
+				d.strictValue(child, k, childSection(child, k), t.Elem(),
+					obj[k], errs)
+			} else {
+				d.strictValue(section, key, childSection(child, k),
+					t.Elem(), obj[k], errs)
+			}
+		}
+
+	default:
+		if !isConfScalar(t) {
+			return
+		}
+
+		var (
+			ok  bool
+			err error
+		)
+
+		str, isStr := iniValue(v)
+		switch {
+		case !d.ini:
+			ok, err = jsonToValue(reflect.New(t).Elem(), v)
+		case !isStr:
+		case str == "": // empty ini value means default
+			return
+		default:
+			ok, err = strToValue(reflect.New(t).Elem(), str)
+			v = str
+		}
+
+		if err == nil && !ok {
+			malformedConf(section, key, v, t, errs)
+		}
+	}
+}
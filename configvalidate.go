@@ -0,0 +1,362 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib config validation
+
+package golib
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Error of an invalid config key
+type ConfigKeyError struct {
+	// Section of key, child section of nested struct is joined by ".",
+	// element of list is followed by [index]
+	Section string
+
+	Key    string
+	Reason string
+}
+
+func (e *ConfigKeyError) Error() string {
+	return fmt.Sprintf("section: %s, key: %s, %s",
+		e.Section, e.Key, e.Reason)
+}
+
+// Error of config, all invalid keys are listed
+type ConfigError struct {
+	Errors []*ConfigKeyError
+}
+
+func (e *ConfigError) Error() string {
+	errs := make([]string, 0, len(e.Errors))
+	for _, ke := range e.Errors {
+		errs = append(errs, ke.Error())
+	}
+
+	return "Invalid config: " + strings.Join(errs, "; ")
+}
+
+func (e *ConfigError) add(section string, key string, format string,
+	v ...interface{}) {
+
+	e.Errors = append(e.Errors, &ConfigKeyError{
+		Section: section,
+		Key:     key,
+		Reason:  fmt.Sprintf(format, v...),
+	})
+}
+
+// Return nil if no invalid key, used as return value of error interface
+func (e *ConfigError) errorOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// Get key name and child section name of field in section
+type confNamer func(section string, field reflect.StructField) (key string,
+	child string)
+
+func iniNamer(section string, field reflect.StructField) (string, string) {
+	return strings.ToLower(field.Name), childSection(section, field.Name)
+}
+
+func jsonNamer(section string, field reflect.StructField) (string, string) {
+	key := jsonKey(field)
+
+	return key, childSection(section, key)
+}
+
+var (
+	patterns     = make(map[string]*regexp.Regexp)
+	patternsLock sync.Mutex
+)
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	patternsLock.Lock()
+	defer patternsLock.Unlock()
+
+	if re, ok := patterns[pattern]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns[pattern] = re
+
+	return re, nil
+}
+
+// Validate struct v reflected from section by validation tags:
+//
+//	required:"true": value must not be zero value, empty list or empty map
+//	min:"1", max:"65535": range of number, or length of string, list, map
+//	oneof:"debug info error": value must be one of values split by space
+//	pattern:"^[a-z]+$": string must match regular expression
+//
+// oneof and pattern are checked for each element of list and map
+func validateConfig(section string, v reflect.Value, namer confNamer,
+	errs *ConfigError) {
+
+	t := v.Type()
+	n := t.NumField()
+
+	for i := 0; i < n; i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		if field.PkgPath != "" && !field.Anonymous { // unexported
+			continue
+		}
+
+		key, child := namer(section, field)
+
+		if field.Anonymous {
+			if value.Kind() == reflect.Ptr && !value.IsNil() {
+				value = value.Elem()
+			}
+
+			if value.Kind() == reflect.Struct {
+				validateConfig(section, value, namer, errs)
+				continue
+			}
+		}
+
+		validateField(section, key, child, field, value, namer, errs)
+	}
+}
+
+func validateField(section string, key string, child string,
+	field reflect.StructField, value reflect.Value, namer confNamer,
+	errs *ConfigError) {
+
+	if field.Tag.Get("required") == "true" && isZeroConf(value) {
+		errs.add(section, key, "required")
+		return
+	}
+
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return
+		}
+
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		validateConfig(child, value, namer, errs)
+		return
+
+	case reflect.Slice:
+		if isConfStruct(value.Type().Elem()) {
+			for i := 0; i < value.Len(); i++ {
+				elem := fmt.Sprintf("%s[%d]", child, i)
+				validateElem(elem, value.Index(i), namer, errs)
+			}
+			return
+		}
+
+		validateLength(section, key, field, value, errs)
+		for i := 0; i < value.Len(); i++ {
+			validateValue(section, key, field, value.Index(i), errs)
+		}
+		return
+
+	case reflect.Map:
+		if isConfStruct(value.Type().Elem()) {
+			for _, k := range value.MapKeys() {
+				validateElem(childSection(child, k.String()),
+					value.MapIndex(k), namer, errs)
+			}
+			return
+		}
+
+		validateLength(section, key, field, value, errs)
+		for _, k := range value.MapKeys() {
+			elem := value.MapIndex(k)
+			validateValue(section, key, field, elem, errs)
+		}
+		return
+
+	case reflect.String:
+		validateLength(section, key, field, value, errs)
+
+	default:
+		validateRange(section, key, field, value, errs)
+	}
+
+	validateValue(section, key, field, value, errs)
+}
+
+// Validate struct or pointer to struct element in list or map
+func validateElem(section string, elem reflect.Value, namer confNamer,
+	errs *ConfigError) {
+
+	if elem.Kind() == reflect.Ptr {
+		if elem.IsNil() {
+			return
+		}
+
+		elem = elem.Elem()
+	}
+
+	validateConfig(section, elem, namer, errs)
+}
+
+// Return true if field has any validation tag
+func hasValidation(field reflect.StructField) bool {
+	for _, tag := range []string{"required", "min", "max", "oneof",
+		"pattern"} {
+
+		if _, ok := field.Tag.Lookup(tag); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isZeroConf(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	}
+
+	return value.IsZero()
+}
+
+// Check min and max tag for length of string, list or map
+func validateLength(section string, key string, field reflect.StructField,
+	value reflect.Value, errs *ConfigError) {
+
+	l := value.Len()
+
+	if min := field.Tag.Get("min"); min != "" {
+		if m, err := strconv.Atoi(min); err != nil {
+			errs.add(section, key, "invalid min tag %s", min)
+		} else if l < m {
+			errs.add(section, key, "length %d less than min %d",
+				l, m)
+		}
+	}
+
+	if max := field.Tag.Get("max"); max != "" {
+		if m, err := strconv.Atoi(max); err != nil {
+			errs.add(section, key, "invalid max tag %s", max)
+		} else if l > m {
+			errs.add(section, key, "length %d greater than max %d",
+				l, m)
+		}
+	}
+}
+
+// Check min and max tag for number
+func validateRange(section string, key string, field reflect.StructField,
+	value reflect.Value, errs *ConfigError) {
+
+	if min := field.Tag.Get("min"); min != "" {
+		if c, ok := compareConf(value, min); !ok {
+			errs.add(section, key, "invalid min tag %s", min)
+		} else if c < 0 {
+			errs.add(section, key, "%v less than min %s",
+				value, min)
+		}
+	}
+
+	if max := field.Tag.Get("max"); max != "" {
+		if c, ok := compareConf(value, max); !ok {
+			errs.add(section, key, "invalid max tag %s", max)
+		} else if c > 0 {
+			errs.add(section, key, "%v greater than max %s",
+				value, max)
+		}
+	}
+}
+
+// Check oneof and pattern tag for value
+func validateValue(section string, key string, field reflect.StructField,
+	value reflect.Value, errs *ConfigError) {
+
+	if oneof := field.Tag.Get("oneof"); oneof != "" {
+		found := false
+		str := fmt.Sprint(value)
+
+		for _, o := range strings.Fields(oneof) {
+			if o == str {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			errs.add(section, key, "%s not one of [%s]", str, oneof)
+		}
+	}
+
+	if pattern := field.Tag.Get("pattern"); pattern != "" &&
+		value.Kind() == reflect.String {
+
+		re, err := compilePattern(pattern)
+		if err != nil {
+			errs.add(section, key, "invalid pattern tag %s",
+				pattern)
+		} else if !re.MatchString(value.String()) {
+			errs.add(section, key, "%s not match pattern %s",
+				value.String(), pattern)
+		}
+	}
+}
+
+// Compare number value with bound converted into same type, return
+// -1, 0, 1 if value is less than, equal to, greater than bound.
+// Return false if bound could not be converted or value is not a number
+func compareConf(value reflect.Value, bound string) (int, bool) {
+	b := reflect.New(value.Type()).Elem()
+	if ok, _ := strToValue(b, bound); !ok {
+		return 0, false
+	}
+
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+
+		switch {
+		case value.Int() < b.Int():
+			return -1, true
+		case value.Int() > b.Int():
+			return 1, true
+		}
+		return 0, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+
+		switch {
+		case value.Uint() < b.Uint():
+			return -1, true
+		case value.Uint() > b.Uint():
+			return 1, true
+		}
+		return 0, true
+	case reflect.Float32, reflect.Float64:
+		switch {
+		case value.Float() < b.Float():
+			return -1, true
+		case value.Float() > b.Float():
+			return 1, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,562 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib config tree
+
+package golib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// Decoder of config tree into struct. Tree is a map decoded from json, yaml
+// or toml, or converted from ini sections by newIniTree, so all formats
+// share the same reflection, strict check and validation
+type treeDecoder struct {
+	// key and child section of field
+	namer confNamer
+
+	// tree is converted from ini: values are strings, list is comma
+	// separated or repeated key as an array of its values, empty value means
+	// default, and struct, map and list of struct are child sections named
+	// by field name
+	ini bool
+
+	// order of ini sections, elements of list of struct are in this order
+	order map[string]int
+
+	// out of range values, unknown enum names and bad defaults are added
+	// into errs, and field is set to default value. Malformed values are
+	// added only for fields with validation tags out of strict mode, strict
+	// check adds all of them
+	errs   *ConfigError
+	strict bool
+}
+
+// Decoder of json, yaml and toml
+var jsonDecoder = &treeDecoder{namer: jsonNamer}
+
+// Reflect config tree s into struct it. Tree is a map decoded from json,
+// yaml or toml, values in tree are normalized by normalizeConf
+func treeConfig(s map[string]interface{}, it interface{},
+	opts ...ConfigOption) error {
+
+	return decodeConfig(jsonDecoder, "", s, it, opts...)
+}
+
+// Copy of decoder d adding errors into errs
+func (d *treeDecoder) withErrors(errs *ConfigError,
+	strict bool) *treeDecoder {
+
+	nd := *d
+	nd.errs, nd.strict = errs, strict
+
+	return &nd
+}
+
+// Reflect config tree s of section into struct it by decoder d, then check
+// it in strict mode and validate it
+func decodeConfig(d *treeDecoder, section string, s map[string]interface{},
+	it interface{}, opts ...ConfigOption) error {
+
+	v := reflect.ValueOf(it).Elem()
+	errs := &ConfigError{}
+	strict := hasConfigOption(opts, ConfigStrict)
+
+	if err := d.withErrors(errs, strict).decodeStruct(section, s,
+		v); err != nil {
+
+		return err
+	}
+
+	if strict {
+		d.strictStruct(section, s, v.Type(), errs)
+	}
+	validateConfig(section, v, d.namer, errs)
+
+	return errs.errorOrNil()
+}
+
+// Load config file in path as config tree and its decoder. Format is decided
+// by extension of path: .json, .yaml, .yml and .toml, otherwise INI, secName
+// is the section in INI file. Return section of root of tree, which is ""
+// except INI. If path is empty, tree is an empty INI file
+func loadConfigTree(path string, secName string) (*treeDecoder, string,
+	map[string]interface{}, error) {
+
+	if secName == "DEFAULT" {
+		secName = ""
+	}
+
+	parse, isTree := treeParsers[strings.ToLower(filepath.Ext(path))]
+	if path != "" && isTree {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		s, err := parse(data)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		return jsonDecoder, "", s, nil
+	}
+
+	f := ini.Empty()
+	if path != "" {
+		var err error
+		f, err = ini.LoadSources(ini.LoadOptions{AllowShadows: true}, path)
+		if err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	d, s := newIniTree(f, secName)
+
+	return d, secName, s, nil
+}
+
+// Set fields of struct v to default values
+func confDefaults(section string, v reflect.Value) error {
+	errs := &ConfigError{}
+	if err := jsonDecoder.withErrors(errs, false).decodeStruct(section, nil,
+		v); err != nil {
+
+		return err
+	}
+
+	return errs.errorOrNil()
+}
+
+// Return true if field of type t is a child section in ini
+func isConfSection(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return true
+	case reflect.Slice:
+		return isConfStruct(t.Elem())
+	}
+
+	return false
+}
+
+// Key of field in tree, and child section of its value
+func (d *treeDecoder) fieldKey(section string,
+	field reflect.StructField) (string, string) {
+
+	key, child := d.namer(section, field)
+	if d.ini && isConfSection(field.Type) {
+		key = field.Name
+	}
+
+	return key, child
+}
+
+// Ini value of key, use the last one if key is repeated, return false if
+// v is a section
+func iniValue(v interface{}) (string, bool) {
+	if arr, ok := v.([]interface{}); ok && len(arr) > 0 {
+		v = arr[len(arr)-1]
+	}
+
+	str, ok := v.(string)
+
+	return str, ok
+}
+
+// Ini values of key for list, each value of repeated key is an element,
+// value of single key is comma separated. Empty values are dropped
+func iniValues(v interface{}) []string {
+	arr, ok := v.([]interface{})
+	if !ok {
+		str, _ := v.(string)
+		return splitList(str)
+	}
+
+	var values []string
+	for _, e := range arr {
+		if str, ok := e.(string); ok && str != "" {
+			values = append(values, str)
+		}
+	}
+
+	return values
+}
+
+// Keys of tree m, ini sections are in file order, others are sorted
+func (d *treeDecoder) keys(section string, m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if d.order != nil {
+		sort.SliceStable(keys, func(i, j int) bool {
+			return d.order[childSection(section, keys[i])] <
+				d.order[childSection(section, keys[j])]
+		})
+	}
+
+	return keys
+}
+
+// Return true if key in section exists in tree s, section is relative to
+// root of tree. Empty ini value is same as not exist
+func (d *treeDecoder) exist(s map[string]interface{}, section string,
+	key string) bool {
+
+	if section != "" {
+		for _, k := range strings.Split(section, ".") {
+			s, _ = s[k].(map[string]interface{})
+		}
+	}
+
+	v, ok := s[key]
+	if !ok || !d.ini {
+		return ok
+	}
+
+	str, ok := iniValue(v)
+
+	return ok && str != ""
+}
+
+// Reflect tree s of section into struct v
+func (d *treeDecoder) decodeStruct(section string, s map[string]interface{},
+	v reflect.Value) error {
+
+	t := v.Type()
+	n := t.NumField()
+
+	for i := 0; i < n; i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		if field.PkgPath != "" && !field.Anonymous { // unexported
+			continue
+		}
+
+		if err := d.decodeField(section, s, field, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Nested struct field is reflected from child tree, embedded struct is
+// flattened into the same tree. Pointer to struct is allocated if its child
+// tree exists, pointer to other types is allocated if its key exists or it
+// has a default value
+func (d *treeDecoder) decodeField(section string, s map[string]interface{},
+	field reflect.StructField, value reflect.Value) error {
+
+	key, child := d.fieldKey(section, field)
+	fd := field.Tag.Get("default")
+
+	switch value.Kind() {
+	case reflect.Struct:
+		if field.Anonymous {
+			return d.decodeStruct(section, s, value)
+		}
+
+		m, _ := s[key].(map[string]interface{})
+		return d.decodeStruct(child, m, value)
+
+	case reflect.Ptr:
+		et := value.Type().Elem()
+
+		if et.Kind() == reflect.Struct {
+			m, ok := s[key].(map[string]interface{})
+			if field.Anonymous {
+				m, ok, child = s, true, section
+			}
+
+			if value.IsNil() {
+				if !ok || !value.CanSet() { // unexported embedded pointer
+					return nil
+				}
+
+				value.Set(reflect.New(et))
+			}
+
+			return d.decodeStruct(child, m, value.Elem())
+		}
+
+		if value.IsNil() {
+			if _, ok := s[key]; !ok && fd == "" {
+				return nil
+			}
+
+			value.Set(reflect.New(et))
+		}
+
+		value = value.Elem()
+
+	case reflect.Slice:
+		return d.decodeSlice(section, key, child, field, s[key], value)
+
+	case reflect.Map:
+		return d.decodeMap(section, key, child, field, s[key], value)
+	}
+
+	if !value.CanSet() { // unexported embedded type
+		return nil
+	}
+
+	t := value.Type()
+	if !isConfScalar(t) {
+		return unsupportedConf(section, key, t)
+	}
+
+	ok := false
+
+	if v, exist := s[key]; exist {
+		ok = d.fieldValue(section, key, field, value, v)
+	}
+
+	if !ok {
+		if err := confDefault(field, value); err != nil {
+			d.errs.add(section, key, "%s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Add error of converting value v of key in section. Malformed value is
+// added only for field with validation tags out of strict mode
+func (d *treeDecoder) convertError(section string, key string,
+	field reflect.StructField, v interface{}, t reflect.Type, err error) {
+
+	if err != nil {
+		d.errs.add(section, key, "%s", err.Error())
+		return
+	}
+
+	if !d.strict && hasValidation(field) {
+		malformedConf(section, key, v, t, d.errs)
+	}
+}
+
+// Convert tree value v into scalar value of field, field with enum tag is
+// converted from name of enum value. Return false if v is malformed, out
+// of range or empty ini value
+func (d *treeDecoder) fieldValue(section string, key string,
+	field reflect.StructField, value reflect.Value, v interface{}) bool {
+
+	str, _ := v.(string)
+	if d.ini {
+		var ok bool
+		if str, ok = iniValue(v); !ok || str == "" {
+			return false
+		}
+		v = str
+	}
+
+	var (
+		ok  bool
+		err error
+	)
+
+	if fe := field.Tag.Get("enum"); fe != "" {
+		ok, err = strToEnum(value, fe, str)
+	} else if d.ini {
+		ok, err = strToValue(value, str)
+	} else {
+		ok, err = jsonToValue(value, v)
+	}
+
+	if !ok {
+		d.convertError(section, key, field, v, value.Type(), err)
+	}
+
+	return ok
+}
+
+// Convert tree value v into element of list or map field, element of
+// struct is reflected from tree of child. Errors of scalar element are
+// added as key in section
+func (d *treeDecoder) elemValue(section string, key string, child string,
+	field reflect.StructField, value reflect.Value,
+	v interface{}) (bool, error) {
+
+	t := value.Type()
+
+	if isConfStruct(t) {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			if !d.ini { // keys in ini section of list are not elements
+				d.convertError(section, key, field, v, t, nil)
+			}
+			return false, nil
+		}
+
+		elem, err := newConfStruct(t, func(sv reflect.Value) error {
+			return d.decodeStruct(child, m, sv)
+		})
+		if err != nil {
+			return false, err
+		}
+
+		value.Set(elem)
+
+		return true, nil
+	}
+
+	var (
+		ok  bool
+		err error
+	)
+
+	if d.ini {
+		var str string
+		if str, ok = iniValue(v); ok {
+			v = str
+			ok, err = strToValue(value, str)
+		}
+	} else {
+		ok, err = jsonToValue(value, v)
+	}
+
+	if !ok {
+		d.convertError(section, key, field, v, t, err)
+	}
+
+	return ok, nil
+}
+
+// Reflect tree value v into slice field. In ini, list of struct is
+// reflected from child sections of child, one section for each element,
+// list of scalar is reflected from comma separated value or repeated key.
+// Otherwise list is reflected from array
+func (d *treeDecoder) decodeSlice(section string, key string, child string,
+	field reflect.StructField, v interface{}, value reflect.Value) error {
+
+	t := value.Type()
+	et := t.Elem()
+
+	if !isConfScalar(et) && !isConfStruct(et) {
+		return unsupportedConf(section, key, t)
+	}
+
+	list := reflect.Zero(t)
+	ok := false
+
+	switch {
+	case d.ini && isConfStruct(et):
+		m, _ := v.(map[string]interface{})
+		for _, name := range d.keys(child, m) {
+			elem := reflect.New(et).Elem()
+
+			elemOk, err := d.elemValue(child, name,
+				childSection(child, name), field, elem, m[name])
+			if err != nil {
+				return err
+			}
+
+			if elemOk {
+				list = reflect.Append(list, elem)
+			}
+		}
+
+		ok = list.Len() > 0
+
+	default:
+		var arr []interface{}
+		if d.ini {
+			for _, str := range iniValues(v) {
+				arr = append(arr, str)
+			}
+		} else if arr, ok = v.([]interface{}); !ok {
+			break
+		}
+
+		list = reflect.MakeSlice(t, len(arr), len(arr))
+		ok = !d.ini || len(arr) > 0
+
+		for i, e := range arr {
+			elemOk, err := d.elemValue(section, key,
+				fmt.Sprintf("%s[%d]", child, i), field, list.Index(i), e)
+			if err != nil {
+				return err
+			}
+
+			if !elemOk {
+				ok = false
+				break
+			}
+		}
+	}
+
+	if !ok {
+		var err error
+		if list, err = defaultSlice(t, field.Tag.Get("default")); err != nil {
+			d.errs.add(section, key, "%s", err.Error())
+		}
+	}
+
+	value.Set(list)
+
+	return nil
+}
+
+// Reflect tree value v into map field, key of map must be string. In ini,
+// map of struct is reflected from child sections of child, name of section
+// is key, map of scalar is reflected from keys in section child
+func (d *treeDecoder) decodeMap(section string, key string, child string,
+	field reflect.StructField, v interface{}, value reflect.Value) error {
+
+	t := value.Type()
+	kt := t.Key()
+	et := t.Elem()
+
+	if kt.Kind() != reflect.String ||
+		(!isConfScalar(et) && !isConfStruct(et)) {
+
+		return unsupportedConf(section, key, t)
+	}
+
+	m, _ := v.(map[string]interface{})
+	res := reflect.MakeMap(t)
+
+	for _, k := range d.keys(child, m) {
+		elem := reflect.New(et).Elem()
+
+		// ini keys of map are keys in section child
+		es, ek := section, key
+		if d.ini {
+			es, ek = child, k
+		}
+
+		ok, err := d.elemValue(es, ek, childSection(child, k), field, elem,
+			m[k])
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			res.SetMapIndex(reflect.ValueOf(k).Convert(kt), elem)
+		}
+	}
+
+	if res.Len() == 0 {
+		res = reflect.Zero(t)
+	}
+
+	value.Set(res)
+
+	return nil
+}
@@ -0,0 +1,199 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib daemon and pid file
+
+package golib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Environment variables for daemon and pid file
+const (
+	// set in daemon process started by Daemon
+	envDaemon = "GOLIB_DAEMON"
+
+	// fd of pid file passed from old process to new process in upgrade
+	envPidFile = "GOLIB_PIDFILE"
+)
+
+// Signals could be sent by SignalProcess
+var processSignals = map[string]syscall.Signal{
+	"stop":    syscall.SIGTERM,
+	"quit":    syscall.SIGQUIT,
+	"reload":  syscall.SIGHUP,
+	"reopen":  syscall.SIGUSR1,
+	"upgrade": syscall.SIGUSR2,
+}
+
+// Run process as daemon. Process will be started again in background with
+// same binary path and arguments in a new session, stdin, stdout and stderr
+// redirected to /dev/null, then current process exits.
+// Should be called at the beginning of main, do nothing in daemon process
+func Daemon() error {
+	// daemon process, or new process started by upgrade
+	if os.Getenv(envDaemon) != "" || os.Getenv(envParent) != "" {
+		os.Unsetenv(envDaemon)
+		return nil
+	}
+
+	path, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer null.Close()
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), envDaemon+"=1")
+	cmd.Stdin = null
+	cmd.Stdout = null
+	cmd.Stderr = null
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err = cmd.Start(); err == nil {
+		os.Exit(0)
+	}
+
+	return err
+}
+
+// Pid file locked by process during its lifetime
+type pidFile struct {
+	path string
+	file *os.File
+}
+
+// Create pid file and lock it. If pid file is locked by another process,
+// return error. If pid file exists but not locked, the process created it
+// has gone, pid file will be reused
+func createPidFile(path string) (*pidFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		f.Close()
+
+		if err == syscall.EWOULDBLOCK {
+			pid, _ := readPidFile(path)
+			return nil, fmt.Errorf("pid file %s locked by process %d",
+				path, pid)
+		}
+
+		return nil, err
+	}
+
+	pf := &pidFile{
+		path: path,
+		file: f,
+	}
+
+	if err := pf.write(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return pf, nil
+}
+
+// Adopt pid file passed from old process in upgrade, old process and new
+// process share the lock of pid file. Return nil if process is not started
+// by upgrade or old process has no pid file
+func inheritPidFile(path string) *pidFile {
+	env := os.Getenv(envPidFile)
+	if env == "" {
+		return nil
+	}
+	os.Unsetenv(envPidFile)
+
+	fd, err := strconv.Atoi(env)
+	if err != nil {
+		return nil
+	}
+
+	return &pidFile{
+		path: path,
+		file: os.NewFile(uintptr(fd), path),
+	}
+}
+
+// Write current pid into pid file
+func (pf *pidFile) write() error {
+	if err := pf.file.Truncate(0); err != nil {
+		return err
+	}
+
+	_, err := pf.file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+
+	return err
+}
+
+// Remove pid file if it still records current pid, and release the lock.
+// Pid file will be kept if new process has taken it over in upgrade
+func (pf *pidFile) remove() {
+	if pid, _ := readPidFile(pf.path); pid == os.Getpid() {
+		os.Remove(pf.path)
+	}
+
+	pf.file.Close()
+}
+
+func readPidFile(path string) (int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// Send signal to running process whose pid recorded in pid file, like
+// nginx -s. cmd could be:
+//
+//	stop: SIGTERM, quit directly
+//	quit: SIGQUIT, quit gracefully
+//	reload: SIGHUP, reload config
+//	reopen: SIGUSR1, reopen logs
+//	upgrade: SIGUSR2, upgrade binary
+func SignalProcess(pidfile string, cmd string) error {
+	sig, ok := processSignals[cmd]
+	if !ok {
+		return fmt.Errorf("unknown signal %s", cmd)
+	}
+
+	f, err := os.Open(pidfile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// pid file not locked, process has gone
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	if err == nil {
+		return fmt.Errorf("process in pid file %s not running", pidfile)
+	}
+
+	if err != syscall.EWOULDBLOCK {
+		return err
+	}
+
+	pid, err := readPidFile(pidfile)
+	if err != nil {
+		return fmt.Errorf("invalid pid file %s, %s", pidfile, err)
+	}
+
+	return syscall.Kill(pid, sig)
+}
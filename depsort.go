@@ -0,0 +1,97 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib dependency sort
+
+package golib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sort names by dependency, a name will be placed after all names it depends
+// on. Names without dependency between each other keep the order in names.
+// deps returns names which name depends on
+func depSort(names []string, deps func(name string) []string) ([]string,
+	error) {
+
+	known := make(map[string]bool)
+	for _, name := range names {
+		known[name] = true
+	}
+
+	for _, name := range names {
+		for _, dep := range deps(name) {
+			if !known[dep] {
+				return nil, fmt.Errorf("%s depends on unknown %s", name, dep)
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	done := make(map[string]bool)
+
+	for len(sorted) < len(names) {
+		progress := false
+
+		for _, name := range names {
+			if done[name] {
+				continue
+			}
+
+			ready := true
+			for _, dep := range deps(name) {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				sorted = append(sorted, name)
+				done[name] = true
+				progress = true
+				break
+			}
+		}
+
+		if !progress {
+			return nil, fmt.Errorf("dependency cycle: %s",
+				depCycle(names, done, deps))
+		}
+	}
+
+	return sorted, nil
+}
+
+// Find a dependency cycle in names not done, return as "a -> b -> a"
+func depCycle(names []string, done map[string]bool,
+	deps func(name string) []string) string {
+
+	var path []string
+	visited := make(map[string]int) // index in path + 1
+
+	name := ""
+	for _, n := range names {
+		if !done[n] {
+			name = n
+			break
+		}
+	}
+
+	for visited[name] == 0 {
+		path = append(path, name)
+		visited[name] = len(path)
+
+		for _, dep := range deps(name) {
+			if !done[dep] {
+				name = dep
+				break
+			}
+		}
+	}
+
+	cycle := append(path[visited[name]-1:], name)
+
+	return strings.Join(cycle, " -> ")
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"golib"
 	"net/http"
+	"os"
 	"time"
 )
 
@@ -78,5 +79,8 @@ func main() {
 
 	ms.AddModule("httpserver", &HTTPServerModule{})
 
-	ms.Start()
+	if err := ms.Start(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
@@ -1,10 +1,13 @@
 module github.com/AlexWoo/golib
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/go-ini/ini v1.41.0
 	github.com/gorilla/websocket v1.4.0
 	github.com/smartystreets/goconvey v0.0.0-20190222223459-a17d461953aa // indirect
 	github.com/tidwall/gjson v1.1.5
 	github.com/tidwall/match v1.0.1 // indirect
+	golang.org/x/sys v0.7.0
 	gopkg.in/ini.v1 v1.42.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
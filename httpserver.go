@@ -192,6 +192,22 @@ func (s *HTTPServer) log(hw *httpWriter) {
 
 // handle a new http request
 func (s *HTTPServer) handler(w http.ResponseWriter, req *http.Request) {
+	s.serve(w, req, s.handle)
+}
+
+// Expose reload reports on location, see ReloadReportHandler.
+// Should be called before Start
+func (s *HTTPServer) HandleReloadReport(location string) {
+	s.serveMux.HandleFunc(location,
+		func(w http.ResponseWriter, req *http.Request) {
+			s.serve(w, req, ReloadReportHandler)
+		})
+}
+
+// call handle for http request and record access log
+func (s *HTTPServer) serve(w http.ResponseWriter, req *http.Request,
+	handle func(w http.ResponseWriter, req *http.Request)) {
+
 	writer := &httpWriter{
 		ResponseWriter: w,
 		requestTime:    time.Now(),
@@ -206,19 +222,32 @@ func (s *HTTPServer) handler(w http.ResponseWriter, req *http.Request) {
 		},
 	}
 
-	s.handle(writer, req)
+	handle(writer, req)
 
 	s.log(writer)
 }
 
-// Start HTTP Server, if close normal, will return nil, otherwise return error
+// Start HTTP Server, if close normal, will return nil, otherwise return error.
+// Listener of HTTP Server is opened by Listen, it will be passed to
+// new process when Modules upgrade
 func (s *HTTPServer) Start() error {
-	var err error
+	addr := s.server.Addr
+	if addr == "" {
+		addr = ":http"
+		if s.tls {
+			addr = ":https"
+		}
+	}
+
+	l, err := Listen(addr)
+	if err != nil {
+		return err
+	}
 
 	if s.certfile == "" || s.keyfile == "" { // http
-		err = s.server.ListenAndServe()
+		err = s.server.Serve(l)
 	} else { // https
-		err = s.server.ListenAndServeTLS(s.certfile, s.keyfile)
+		err = s.server.ServeTLS(l, s.certfile, s.keyfile)
 	}
 
 	if err == http.ErrServerClosed {
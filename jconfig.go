@@ -7,76 +7,25 @@ package golib
 import (
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/tidwall/gjson"
 )
 
-func jsonBoolean(key string, m map[string]interface{}, dv bool) bool {
-	v, ok := m[key].(bool)
-	if !ok {
-		return dv
-	}
-
-	return v
-}
-
-func jsonString(key string, m map[string]interface{}, dv string) string {
-	v, ok := m[key].(string)
-	if !ok {
-		return dv
-	}
-
-	return v
-}
-
-func jsonUint64(key string, m map[string]interface{}, dv uint64) uint64 {
-	v, ok := m[key].(float64)
-	if !ok {
-		return dv
-	}
-
-	if v < 0 {
-		return dv
-	}
-
-	return uint64(v)
-}
-
-func jsonInt64(key string, m map[string]interface{}, dv int64) int64 {
-	v, ok := m[key].(float64)
-	if !ok {
-		return dv
-	}
-
-	return int64(v)
-}
-
-func jsonSize(key string, m map[string]interface{}, dv Size) Size {
-	v, ok := m[key].(string)
-	if !ok {
-		return dv
-	}
-
-	return confSize(v, dv)
-}
-
-func jsonDuration(key string, m map[string]interface{},
-	dv time.Duration) time.Duration {
-
-	v, ok := m[key].(string)
-	if !ok {
-		return dv
-	}
-
-	return confTimeDuration(v, dv)
-}
-
 // Reflect json config into struct
 //
+// JSON, YAML and TOML config share the same reflection, see treeConfig.
+//
+// Fields could be validated by tags required, min, max, oneof and pattern,
+// all invalid keys are returned in *ConfigError. With option ConfigStrict,
+// keys not mapped to any field and values of wrong type are also returned
+// in *ConfigError, see Config.
+//
 // Example:
 //
 // test.ini:
@@ -102,10 +51,12 @@ func jsonDuration(key string, m map[string]interface{},
 //		CInt64    int64         `default:"-100"`
 //		CSize     golib.Size    `default:"10M"`
 //		CDuration time.Duration `default:"20s"`
-//		CEnum     string        `default:"T2"`
+//		CEnum     int           `enum:"t" default:"T2"`
 //	}
 //
 //	func main() {
+//		golib.RegisterEnum("t", enumT)
+//
 //		config := &Config{}
 //		err := golib.JsonConfigFile("test/config.json", config)
 //		if err != nil {
@@ -117,51 +68,250 @@ func jsonDuration(key string, m map[string]interface{},
 //	}
 //
 // Result:
-//	&{true Hello World 100 -100 10M 20s T2}
-func JsonConfig(json string, it interface{}) error {
-	s, ok := gjson.Parse(json).Value().(map[string]interface{})
+//	&{true Hello World 100 -100 10M 20s 1}
+func JsonConfig(json string, it interface{}, opts ...ConfigOption) error {
+	s, err := parseJson([]byte(json))
+	if err != nil {
+		return err
+	}
+
+	return treeConfig(s, it, opts...)
+}
+
+func parseJson(json []byte) (map[string]interface{}, error) {
+	s, ok := gjson.ParseBytes(json).Value().(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a json map: %s", string(json))
+	}
+
+	return s, nil
+}
+
+// Parsers of config formats decoded as tree, key is file extension
+var treeParsers = map[string]func([]byte) (map[string]interface{}, error){
+	".json": parseJson,
+	".yaml": parseYaml,
+	".yml":  parseYaml,
+	".toml": parseToml,
+}
+
+// Normalize value decoded from yaml or toml into types decoded from json:
+// map[string]interface{}, []interface{}, string, float64, bool and nil.
+// Integer is kept exact as int64 or uint64, key of map is converted into
+// string, time is converted into RFC3339 string
+func normalizeConf(v interface{}) interface{} {
+	switch cv := v.(type) {
+	case nil, bool, string, float64, int64, uint64:
+		return v
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(cv))
+		for k, e := range cv {
+			m[k] = normalizeConf(e)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(cv))
+		for k, e := range cv {
+			m[fmt.Sprint(k)] = normalizeConf(e)
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(cv))
+		for i, e := range cv {
+			arr[i] = normalizeConf(e)
+		}
+		return arr
+	case []map[string]interface{}:
+		arr := make([]interface{}, len(cv))
+		for i, e := range cv {
+			arr[i] = normalizeConf(e)
+		}
+		return arr
+	case time.Time:
+		return cv.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return cv.String()
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+
+		return rv.Uint()
+	case reflect.Float32:
+		return rv.Float()
+	}
+
+	return v
+}
+
+// Key of field in json, use json tag if set, otherwise lower case of name
+func jsonKey(field reflect.StructField) string {
+	if fj := field.Tag.Get("json"); fj != "" {
+		return fj
+	}
+
+	return strings.ToLower(field.Name)
+}
+
+func unsupportedJsonConf(fn string, t reflect.Type) error {
+	return fmt.Errorf("Unsuppoted json config, name: %s, type: %s\n",
+		fn, t.String())
+}
+
+// Convert json value v into scalar value, return false if v is invalid for
+// type of value
+func jsonToValue(value reflect.Value, v interface{}) (bool, error) {
+	t := value.Type()
+
+	if t == sizeType || t == durationType {
+		str, ok := v.(string)
+		if !ok {
+			return false, nil
+		}
+
+		return strToValue(value, str)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := v.(bool)
+		if ok {
+			value.SetBool(b)
+		}
+		return ok, nil
+	case reflect.String:
+		str, ok := v.(string)
+		if ok {
+			value.SetString(str)
+		}
+		return ok, nil
+	}
+
+	switch n := v.(type) {
+	case int64:
+		return intToValue(value, n)
+	case uint64:
+		return uintToValue(value, n)
+	}
+
+	f, ok := v.(float64)
 	if !ok {
-		return fmt.Errorf("not a json map: %s", string(json))
+		return false, nil
+	}
+
+	str := strconv.FormatFloat(f, 'f', -1, 64)
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+
+		if f != math.Trunc(f) {
+			return false, nil
+		}
+
+		if f < math.MinInt64 || f >= math.MaxInt64 ||
+			value.OverflowInt(int64(f)) {
+
+			return false, rangeError(str, t)
+		}
+
+		value.SetInt(int64(f))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+
+		if f < 0 || f != math.Trunc(f) {
+			return false, nil
+		}
+
+		if f >= math.MaxUint64 || value.OverflowUint(uint64(f)) {
+			return false, rangeError(str, t)
+		}
+
+		value.SetUint(uint64(f))
+	case reflect.Float32, reflect.Float64:
+		if value.OverflowFloat(f) {
+			return false, rangeError(str, t)
+		}
+
+		value.SetFloat(f)
+	default:
+		return false, nil
 	}
 
-	t := reflect.TypeOf(it).Elem()
-	v := reflect.ValueOf(it).Elem()
-	n := t.NumField()
-
-	for i := 0; i < n; i++ {
-		field := t.Field(i)
-		value := v.Field(i)
-		fn := strings.ToLower(field.Name)
-		ft := field.Type.Name()
-		fd := field.Tag.Get("default")
-		fj := field.Tag.Get("json")
-		if fj != "" {
-			fn = fj
-		}
-
-		switch ft {
-		case "bool":
-			value.SetBool(jsonBoolean(fn, s, defaultBoolean(fd)))
-		case "string":
-			value.SetString(jsonString(fn, s, fd))
-		case "uint64":
-			value.SetUint(jsonUint64(fn, s, defaultUint64(fd)))
-		case "int64":
-			value.SetInt(jsonInt64(fn, s, defaultInt64(fd)))
-		case "Size":
-			value.SetInt(int64(jsonSize(fn, s, defaultSize(fd))))
-		case "Duration":
-			value.SetInt(int64(jsonDuration(fn, s, defaultTimeDuration(fd))))
-		default:
-			return fmt.Errorf("Unsuppoted json config, name: %s, type: %s\n",
-				fn, ft)
+	return true, nil
+}
+
+// Convert integer n decoded from yaml or toml into number value exactly,
+// return false if value is not a number or n is negative for unsigned value
+func intToValue(value reflect.Value, n int64) (bool, error) {
+	t := value.Type()
+	str := strconv.FormatInt(n, 10)
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+
+		if value.OverflowInt(n) {
+			return false, rangeError(str, t)
 		}
+
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+
+		if n < 0 {
+			return false, nil
+		}
+
+		return uintToValue(value, uint64(n))
+	case reflect.Float32, reflect.Float64:
+		value.SetFloat(float64(n))
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Convert unsigned integer n decoded from yaml or toml into number value
+// exactly, see intToValue
+func uintToValue(value reflect.Value, n uint64) (bool, error) {
+	t := value.Type()
+
+	switch t.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+
+		if value.OverflowUint(n) {
+			return false, rangeError(strconv.FormatUint(n, 10), t)
+		}
+
+		value.SetUint(n)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+
+		if n > math.MaxInt64 {
+			return false, rangeError(strconv.FormatUint(n, 10), t)
+		}
+
+		return intToValue(value, int64(n))
+	case reflect.Float32, reflect.Float64:
+		value.SetFloat(float64(n))
+	default:
+		return false, nil
 	}
 
-	return nil
+	return true, nil
 }
 
-func JsonConfigFile(path string, it interface{}) error {
+// Load json file in path and reflect into struct it, see JsonConfig
+func JsonConfigFile(path string, it interface{}, opts ...ConfigOption) error {
 	f, err := os.Open(path)
 	if err != nil {
 		return err
@@ -173,5 +323,5 @@ func JsonConfigFile(path string, it interface{}) error {
 		return fmt.Errorf("Invalid json: %s", string(json))
 	}
 
-	return JsonConfig(string(json), it)
+	return JsonConfig(string(json), it, opts...)
 }
@@ -5,8 +5,18 @@
 package golib
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -29,22 +39,164 @@ type Module interface {
 	Exit()
 }
 
+// Context-aware Module interface, ctx in PreInit, Init and PreMainloop is
+// the module manager's context. ctx in Mainloop will be cancelled when
+// module exiting, ctx in Exit carries the deadline for module exit
+type ContextModule interface {
+	// Do something before Module init
+	PreInit(ctx context.Context) error
+
+	// Module init, such as load config, init control paras
+	Init(ctx context.Context) error
+
+	// Do something before enter in mainloop
+	PreMainloop(ctx context.Context) error
+
+	// Run mainloop, return when ctx cancelled
+	Mainloop(ctx context.Context)
+
+	// Exit mainloop before ctx deadline
+	Exit(ctx context.Context)
+}
+
+// Adapt Module to ContextModule
+type moduleAdapter struct {
+	m Module
+}
+
+func (a *moduleAdapter) PreInit(ctx context.Context) error {
+	return a.m.PreInit()
+}
+
+func (a *moduleAdapter) Init(ctx context.Context) error {
+	return a.m.Init()
+}
+
+func (a *moduleAdapter) PreMainloop(ctx context.Context) error {
+	return a.m.PreMainloop()
+}
+
+func (a *moduleAdapter) Mainloop(ctx context.Context) {
+	a.m.Mainloop()
+}
+
+func (a *moduleAdapter) Exit(ctx context.Context) {
+	a.m.Exit()
+}
+
+// Default module exit timeout
+const moduleExitTimeout = 5 * time.Second
+
+// Returned by Modules.Start if modules failed to exit in time
+var ErrForcedExit = errors.New("modules exit forced")
+
+// Error returned by Modules.Start if module failed in start phase
+type ModuleError struct {
+	// Module name, empty if error is not caused by a single module
+	Module string
+
+	// Phase in which error occurs: dependency, pidfile, PreInit, Init,
+	// PreMainloop
+	Phase string
+
+	Err error
+}
+
+func (e *ModuleError) Error() string {
+	if e.Module == "" {
+		return fmt.Sprintf("module %s error: %s", e.Phase, e.Err.Error())
+	}
+
+	return fmt.Sprintf("module %s %s error: %s", e.Module, e.Phase,
+		e.Err.Error())
+}
+
 type modulectx struct {
-	m     Module
-	timer *Timer
+	name     string
+	m        ContextModule
+	deps     []string
+	timer    *Timer
+	closed   bool
+	timedout bool
+	state    ModuleState
+
+	// mainloop panicked
+	failed       bool
+	restarts     int
+	restartTimer *Timer
+
+	// goroutine id of module mainloop
+	gid uint64
+
+	// Mainloop context
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Exit context
+	exitCancel context.CancelFunc
+
+	// Closed when module unloaded
+	unloaded chan bool
 }
 
 // Module manage
 type Modules struct {
 	modules map[string]*modulectx
 	callseq []string
+	lock    sync.RWMutex
 
 	// Module alived number
-	closeModule chan string
-	nModule     uint
+	closeModule   chan *modulectx
+	timeoutModule chan *modulectx
+	restartModule chan *modulectx
+	nModule       uint
+
+	restartPolicies map[string]RestartPolicy
+
+	// Module manager context, cancelled when system exit
+	ctx    context.Context
+	cancel context.CancelFunc
 
-	// Signals
-	signals chan os.Signal
+	// Modules wait for exit, in reverse dependency order
+	exitseq []string
+	exiting bool
+	forced  bool
+	quit    chan bool
+
+	// Exit timeout for each module, and for whole system
+	exitTimeout     time.Duration
+	exitTimeouts    map[string]time.Duration
+	shutdownTimeout time.Duration
+	shutdownTimer   *Timer
+	timeoutShutdown chan bool
+
+	// mainloop is running, and will quit
+	running  bool
+	quitting bool
+
+	// Signals, sigsrc is where mainloop receives signals from
+	signals  chan os.Signal
+	sigsrc   <-chan os.Signal
+	handlers map[os.Signal]func(os.Signal)
+
+	// Function called in mainloop goroutine
+	ctrl chan func()
+
+	// goroutine id of mainloop
+	gid uint64
+
+	// new process started by upgrade
+	upgrading *exec.Cmd
+
+	// close inherited listeners not claimed in time
+	inheritedTimer *Timer
+
+	// reloaders are reloading in mainloop
+	reloading bool
+
+	// pid file
+	pidpath string
+	pidfile *pidFile
 
 	// log
 	log      *Log
@@ -59,19 +211,84 @@ func NewModules() *Modules {
 		return modules
 	}
 
-	modules = &Modules{
-		modules:     make(map[string]*modulectx),
-		closeModule: make(chan string),
-		signals:     make(chan os.Signal),
-	}
+	modules = NewModuleManager()
 
 	return modules
 }
 
-// Add User Module in module manager
-func (ms *Modules) AddModule(name string, m Module) {
+// New a module manager instance, unlike NewModules, each call returns a new
+// instance, used for multi module managers in one process or testing
+func NewModuleManager() *Modules {
+	ms := &Modules{
+		modules:       make(map[string]*modulectx),
+		closeModule:   make(chan *modulectx),
+		timeoutModule: make(chan *modulectx),
+		restartModule: make(chan *modulectx),
+		quit:          make(chan bool),
+		exitTimeout:   moduleExitTimeout,
+		exitTimeouts:  make(map[string]time.Duration),
+
+		restartPolicies: make(map[string]RestartPolicy),
+
+		timeoutShutdown: make(chan bool),
+
+		signals:  make(chan os.Signal),
+		handlers: make(map[os.Signal]func(os.Signal)),
+		ctrl:     make(chan func()),
+	}
+
+	ms.sigsrc = ms.signals
+
+	// quit gracefully
+	ms.handlers[syscall.SIGQUIT] = func(os.Signal) { ms.stop() }
+	ms.handlers[syscall.SIGINT] = func(os.Signal) { ms.stop() }
+
+	// quit directly
+	ms.handlers[syscall.SIGTERM] = func(os.Signal) { ms.terminate() }
+
+	// reload config
+	ms.handlers[syscall.SIGHUP] = func(os.Signal) { ms.reload() }
+
+	// reopen logs
+	ms.handlers[syscall.SIGUSR1] = func(os.Signal) { ms.reopen() }
+
+	// upgrade binary
+	ms.handlers[syscall.SIGUSR2] = func(os.Signal) { ms.upgrade() }
+
+	// ignore signals
+	ms.handlers[syscall.SIGALRM] = nil
+	ms.ctx, ms.cancel = context.WithCancel(context.Background())
+
+	return ms
+}
+
+// Add User Module in module manager, deps are names of modules m depends on.
+// m will be inited after all modules it depends on,
+// and exit before all modules it depends on.
+// If name has been added, the module and its deps will be replaced
+func (ms *Modules) AddModule(name string, m Module, deps ...string) {
+	ms.AddContextModule(name, &moduleAdapter{m: m}, deps...)
+}
+
+// Add User ContextModule in module manager, deps are same as AddModule.
+// AddModule and AddContextModule must be called before Start,
+// use LoadModule or LoadContextModule after Start
+func (ms *Modules) AddContextModule(name string, m ContextModule,
+	deps ...string) {
+
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if mctx, ok := ms.modules[name]; ok {
+		mctx.m = m
+		mctx.deps = deps
+		return
+	}
+
 	mctx := &modulectx{
-		m: m,
+		name: name,
+		m:    m,
+		deps: deps,
 	}
 
 	ms.modules[name] = mctx
@@ -79,6 +296,42 @@ func (ms *Modules) AddModule(name string, m Module) {
 	ms.nModule++
 }
 
+// Set exit timeout, module is the default time waiting for each module
+// exiting, global is the time waiting for all modules exiting, 0 means no
+// limit. Modules not exit in time will be reported in log, and Start will
+// return ErrForcedExit
+func (ms *Modules) SetExitTimeout(module time.Duration, global time.Duration) {
+	ms.exitTimeout = module
+	ms.shutdownTimeout = global
+}
+
+// Set exit timeout for module whose name is name, overrides the default
+// module exit timeout set by SetExitTimeout
+func (ms *Modules) SetModuleExitTimeout(name string, timeout time.Duration) {
+	ms.exitTimeouts[name] = timeout
+}
+
+// Get exit timeout of module whose name is name
+func (ms *Modules) exitTimeoutOf(name string) time.Duration {
+	if timeout, ok := ms.exitTimeouts[name]; ok {
+		return timeout
+	}
+
+	return ms.exitTimeout
+}
+
+// Context passed to Exit of module whose name is name, it is done when exit
+// timeout of module expires, or never if timeout is 0
+func (ms *Modules) exitContext(name string) (context.Context,
+	context.CancelFunc) {
+
+	if timeout := ms.exitTimeoutOf(name); timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+
+	return context.WithCancel(context.Background())
+}
+
 func (ms *Modules) Prefix() string {
 	return ""
 }
@@ -91,19 +344,166 @@ func (ms *Modules) LogLevel() int {
 	return ms.loglevel
 }
 
-// Start module system
-func (ms *Modules) Start() {
-	ms.preInit()
+// Start module system, return until all modules exit. If any module failed
+// in start phase, modules already inited will exit, and return *ModuleError.
+// If modules failed to exit in time, return ErrForcedExit
+func (ms *Modules) Start() error {
+	if err := ms.sortModules(); err != nil {
+		return &ModuleError{Phase: "dependency", Err: err}
+	}
+
+	if err := ms.createPidFile(); err != nil {
+		return &ModuleError{Phase: "pidfile", Err: err}
+	}
+
+	if err := ms.preInit(); err != nil {
+		ms.abort()
+		return err
+	}
 	ms.log.LogError(ms, "start system ...")
 
 	ms.log.LogInfo(ms, "init ...")
-	ms.init()
+	if err := ms.init(); err != nil {
+		ms.abort()
+		return err
+	}
 
 	ms.log.LogInfo(ms, "pre mainloop ...")
-	ms.preMainloop()
+	if err := ms.preMainloop(); err != nil {
+		ms.abort()
+		return err
+	}
 
 	ms.log.LogInfo(ms, "mainloop ...")
 	ms.mainloop()
+
+	if ms.pidfile != nil {
+		ms.pidfile.remove()
+	}
+
+	if ms.forced {
+		return ErrForcedExit
+	}
+
+	return nil
+}
+
+// Set signal source, module manager will receive signals from c instead of
+// registering handlers for process signals. Must be called before Start
+func (ms *Modules) SetSignalSource(c <-chan os.Signal) {
+	ms.sigsrc = c
+}
+
+// Register handler h for signal s, override the default action of s.
+// Handlers are called in module manager's mainloop one by one, serialized
+// with reload and reopen. If h is nil, s will be ignored.
+// Must be called before Start
+//
+// Default actions:
+//
+//	SIGQUIT, SIGINT: Stop
+//	SIGTERM: Quit
+//	SIGHUP: Reload
+//	SIGUSR1: Reopen
+//	SIGUSR2: Upgrade
+//	SIGALRM: ignored
+//
+// Example:
+//
+// Write heap profile when receiving SIGUSR2:
+//
+//	ms.HandleSignal(syscall.SIGUSR2, func(s os.Signal) {
+//		f, err := os.Create("heap.prof")
+//		if err != nil {
+//			return
+//		}
+//		defer f.Close()
+//
+//		pprof.WriteHeapProfile(f)
+//	})
+func (ms *Modules) HandleSignal(s os.Signal, h func(s os.Signal)) {
+	ms.handlers[s] = h
+}
+
+// Stop module system gracefully as receiving SIGINT, if system is exiting,
+// force exit. Stop, Quit, Reload and Reopen must be called after Start,
+// could be called in signal handlers. Stop, Quit and Reopen could also be
+// called in reloaders. Reload called in reloaders reloaded by module system
+// is ignored, and must not be called in reloaders reloaded by golib.Reload
+// in other goroutine, as reload lock is held until all reloaders return
+func (ms *Modules) Stop() {
+	ms.call(ms.stop)
+}
+
+// Quit module system directly as receiving SIGTERM
+func (ms *Modules) Quit() {
+	ms.call(ms.terminate)
+}
+
+// Reload all reloaders as receiving SIGHUP
+func (ms *Modules) Reload() {
+	ms.call(ms.reload)
+}
+
+// Reopen all logs as receiving SIGUSR1
+func (ms *Modules) Reopen() {
+	ms.call(ms.reopen)
+}
+
+// Upgrade binary without dropping connections as receiving SIGUSR2.
+// New process will be started with same binary path and arguments,
+// listeners opened by Listen, such as HTTPServer, will be passed to it.
+// When new process enters mainloop, it notifies old process to exit
+// gracefully. If new process failed to start, old process keeps running
+func (ms *Modules) Upgrade() {
+	ms.call(ms.upgrade)
+}
+
+// Call f in mainloop, return after f return or mainloop quit,
+// return false if f is not called
+func (ms *Modules) call(f func()) bool {
+	// called in mainloop
+	if atomic.LoadUint64(&ms.gid) == goroutineId() {
+		f()
+		return true
+	}
+
+	done := make(chan bool)
+
+	select {
+	case ms.ctrl <- func() { f(); close(done) }:
+		<-done
+		return true
+	case <-ms.quit:
+		return false
+	}
+}
+
+// Set pid file path, pid file will be created and locked when Start, and
+// removed when exit. Start will fail if pid file is locked by another
+// running process. Pid file will be taken over by new process in upgrade
+func (ms *Modules) SetPidFile(path string) {
+	ms.pidpath = path
+}
+
+func (ms *Modules) createPidFile() error {
+	if ms.pidpath == "" {
+		return nil
+	}
+
+	ms.pidfile = inheritPidFile(ms.pidpath)
+	if ms.pidfile != nil {
+		return nil
+	}
+
+	pf, err := createPidFile(ms.pidpath)
+	if err != nil {
+		return err
+	}
+
+	ms.pidfile = pf
+
+	return nil
 }
 
 // Set log
@@ -112,28 +512,42 @@ func (ms *Modules) SetLog(log string, loglevel int) {
 	ms.loglevel = loglevel
 }
 
-func (ms *Modules) preInit() error {
-	// init signals
-	// quit gracefully
-	signal.Notify(ms.signals, syscall.SIGQUIT, syscall.SIGINT)
+// Sort callseq by module dependency
+func (ms *Modules) sortModules() error {
+	seq, err := depSort(ms.callseq, func(name string) []string {
+		return ms.modules[name].deps
+	})
+	if err != nil {
+		return err
+	}
 
-	// quit directly
-	signal.Notify(ms.signals, syscall.SIGTERM)
+	ms.lock.Lock()
+	ms.callseq = seq
+	ms.lock.Unlock()
 
-	// reload config
-	signal.Notify(ms.signals, syscall.SIGHUP)
+	return nil
+}
 
-	// reopen logs
-	signal.Notify(ms.signals, syscall.SIGUSR1)
+func (ms *Modules) initSignals() {
+	for s, h := range ms.handlers {
+		if h == nil {
+			signal.Ignore(s)
+		} else {
+			signal.Notify(ms.signals, s)
+		}
+	}
+}
 
-	// ignore signals
-	signal.Ignore(syscall.SIGALRM)
+func (ms *Modules) preInit() error {
+	if ms.sigsrc == ms.signals {
+		ms.initSignals()
+	}
 
 	// pre init user modules
 	for _, name := range ms.callseq {
-		err := ms.modules[name].m.PreInit()
+		err := ms.modules[name].m.PreInit(ms.ctx)
 		if err != nil {
-			return err
+			return &ModuleError{Module: name, Phase: "PreInit", Err: err}
 		}
 	}
 
@@ -144,91 +558,279 @@ func (ms *Modules) preInit() error {
 	return nil
 }
 
-func (ms *Modules) init() {
-	for _, name := range ms.callseq {
-		err := ms.modules[name].m.Init()
+func (ms *Modules) init() error {
+	for i, name := range ms.callseq {
+		err := ms.modules[name].m.Init(ms.ctx)
 		if err != nil {
-			ms.log.LogFatal(ms, "module %s init error %s", name, err.Error())
+			ms.log.LogError(ms, "module %s init error %s", name, err.Error())
+			ms.rollback(ms.callseq[:i])
+
+			return &ModuleError{Module: name, Phase: "Init", Err: err}
 		}
 
 		ms.log.LogInfo(ms, "module %s init successd", name)
 	}
+
+	return nil
 }
 
-func (ms *Modules) preMainloop() {
+func (ms *Modules) preMainloop() error {
 	for _, name := range ms.callseq {
-		err := ms.modules[name].m.PreMainloop()
+		err := ms.modules[name].m.PreMainloop(ms.ctx)
 		if err != nil {
-			ms.log.LogFatal(ms, "module %s pre mainloop error %s",
+			ms.log.LogError(ms, "module %s pre mainloop error %s",
 				name, err.Error())
+			ms.rollback(ms.callseq)
+
+			return &ModuleError{Module: name, Phase: "PreMainloop", Err: err}
 		}
 
 		ms.log.LogInfo(ms, "module %s pre mainloop successd", name)
 	}
+
+	return nil
 }
 
-func (ms *Modules) close(name string) {
-	ms.nModule--
-	ms.closeModule <- name
+// Exit inited modules in reverse order when start failed
+func (ms *Modules) rollback(names []string) {
+	for i := len(names) - 1; i >= 0; i-- {
+		name := names[i]
+
+		ctx, cancel := ms.exitContext(name)
+		ms.modules[name].m.Exit(ctx)
+		cancel()
+
+		ms.log.LogInfo(ms, "module %s rollback", name)
+	}
 }
 
-func (ms *Modules) wrap(name string) {
-	ms.modules[name].m.Mainloop()
+// Release module manager resources when start failed
+func (ms *Modules) abort() {
+	if ms.sigsrc == ms.signals {
+		signal.Stop(ms.signals)
+	}
 
-	t := ms.modules[name].timer
-	if t != nil {
-		t.Stop()
+	for _, name := range ms.callseq {
+		ms.setState(ms.modules[name], ModuleDead)
 	}
 
-	ms.close(name)
+	if ms.pidfile != nil {
+		ms.pidfile.remove()
+	}
+
+	close(ms.quit)
+	ms.cancel()
 }
 
-func (ms *Modules) closeTimeout(n interface{}) {
-	ms.close(n.(string))
+func (ms *Modules) wrap(mctx *modulectx) {
+	atomic.StoreUint64(&mctx.gid, goroutineId())
+
+	mctx.failed = ms.run(mctx)
+
+	select {
+	case ms.closeModule <- mctx:
+	case <-ms.quit:
+	}
 }
 
-func (ms *Modules) mainloop() {
-	for _, name := range ms.callseq {
-		go ms.wrap(name)
+// Run module mainloop, return true if mainloop panicked
+func (ms *Modules) run(mctx *modulectx) (failed bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			ms.log.LogError(ms, "module %s mainloop panic: %v\n%s",
+				mctx.name, err, debug.Stack())
+			failed = true
+		}
+	}()
+
+	mctx.m.Mainloop(mctx.ctx)
+
+	return false
+}
+
+// Start module mainloop
+func (ms *Modules) launch(mctx *modulectx) {
+	mctx.ctx, mctx.cancel = context.WithCancel(ms.ctx)
+	ms.setState(mctx, ModuleRunning)
+
+	go ms.wrap(mctx)
+}
+
+func (ms *Modules) closeTimeout(m interface{}) {
+	select {
+	case ms.timeoutModule <- m.(*modulectx):
+	case <-ms.quit:
 	}
+}
 
-	exit := false
+func (ms *Modules) closeAllTimeout(interface{}) {
+	select {
+	case ms.timeoutShutdown <- true:
+	case <-ms.quit:
+	}
+}
 
-	for {
-		if ms.nModule == 0 {
-			exit = true
-		}
+// Module mainloop has returned or exit timeout
+func (ms *Modules) close(mctx *modulectx, timeout bool) {
+	if mctx.closed {
+		return
+	}
+
+	if timeout {
+		ms.log.LogError(ms, "module %s exit timeout", mctx.name)
+		mctx.timedout = true
+	} else {
+		ms.log.LogInfo(ms, "module %s mainloop exit", mctx.name)
+	}
+
+	if mctx.timer != nil {
+		mctx.timer.Stop()
+	}
+
+	if mctx.exitCancel != nil {
+		mctx.exitCancel()
+	}
+
+	mctx.cancel()
+
+	if !timeout && ms.restart(mctx) {
+		return
+	}
+
+	mctx.closed = true
+	ms.nModule--
+	ms.setState(mctx, ModuleDead)
+
+	if mctx.unloaded != nil {
+		ms.remove(mctx)
+	}
 
-		if exit {
-			break
+	if ms.exiting && len(ms.exitseq) > 0 && ms.exitseq[0] == mctx.name {
+		ms.exitseq = ms.exitseq[1:]
+		ms.exitNext()
+	}
+}
+
+func (ms *Modules) mainloop() {
+	atomic.StoreUint64(&ms.gid, goroutineId())
+
+	ms.lock.Lock()
+	ms.running = true
+	ms.lock.Unlock()
+
+	// take over pid file from old process in upgrade
+	if ms.pidfile != nil {
+		if err := ms.pidfile.write(); err != nil {
+			ms.log.LogError(ms, "write pid file failed, %s", err)
 		}
+	}
+
+	if pid, err := notifyParent(); err != nil {
+		ms.log.LogError(ms, "notify old process %d failed, %s", pid, err)
+	} else if pid != 0 {
+		ms.log.LogError(ms, "upgrade from old process %d", pid)
+	}
+
+	for _, name := range ms.callseq {
+		ms.launch(ms.modules[name])
+	}
+
+	ms.inheritedTimer = NewTimer(inheritedTimeout, ms.closeInherited, nil)
 
+	for !ms.quitting && ms.nModule > 0 {
 		select {
-		case s := <-ms.signals:
-			ms.log.LogInfo(ms, "get signal: %s", s.String())
-
-			switch s {
-			case syscall.SIGINT, syscall.SIGQUIT:
-				ms.exit()
-			case syscall.SIGTERM:
-				exit = true
-			case syscall.SIGHUP:
-				ms.reload()
-			case syscall.SIGUSR1:
-				ms.reopen()
+		case s := <-ms.sigsrc:
+			ms.signal(s)
+		case f := <-ms.ctrl:
+			f()
+		case mctx := <-ms.closeModule:
+			ms.close(mctx, false)
+		case mctx := <-ms.timeoutModule:
+			ms.close(mctx, true)
+		case mctx := <-ms.restartModule:
+			if mctx.restartTimer != nil {
+				mctx.restartTimer = nil
+				ms.launch(mctx)
 			}
-		case <-ms.closeModule:
-			break
+		case <-ms.timeoutShutdown:
+			ms.log.LogError(ms, "exit timeout")
+			ms.forced = true
+			ms.quitting = true
 		}
 	}
 
+	ms.lock.Lock()
+	ms.running = false
+	ms.lock.Unlock()
+
+	if ms.sigsrc == ms.signals {
+		signal.Stop(ms.signals)
+	}
+
+	if ms.shutdownTimer != nil {
+		ms.shutdownTimer.Stop()
+	}
+	ms.inheritedTimer.Stop()
+
+	if ms.exiting {
+		ms.report()
+	}
+
+	close(ms.quit)
+	ms.cancel()
+
 	ms.log.LogError(ms, "system exit")
 }
 
+func (ms *Modules) signal(s os.Signal) {
+	ms.log.LogInfo(ms, "get signal: %s", s.String())
+
+	if h := ms.handlers[s]; h != nil {
+		h(s)
+	}
+}
+
+// Exit directly
+func (ms *Modules) terminate() {
+	ms.quitting = true
+}
+
+// Exit gracefully, force exit if called again
+func (ms *Modules) stop() {
+	if ms.exiting {
+		ms.log.LogError(ms, "force exit")
+		ms.forced = true
+		ms.quitting = true
+		return
+	}
+
+	ms.exit()
+}
+
 func (ms *Modules) reload() {
+	// called by reloader, golib.Reload is not reentrant
+	if ms.reloading {
+		ms.log.LogError(ms, "reload in reloader ignored")
+		return
+	}
+
 	ms.log.LogInfo(ms, "reload ...")
 
-	if err := Reload(""); err != nil {
+	ms.reloading = true
+	report, err := ReloadWithReport("")
+	ms.reloading = false
+
+	for _, r := range report.Reloaders {
+		if r.Success {
+			ms.log.LogInfo(ms, "reload %s successd, %s",
+				r.Name, r.Duration)
+		} else {
+			ms.log.LogError(ms, "reload %s failed, %s: %s",
+				r.Name, r.Duration, r.Error)
+		}
+	}
+
+	if err != nil {
 		ms.log.LogError(ms, "reload failed: %s", err.Error())
 	}
 }
@@ -245,11 +847,182 @@ func (ms *Modules) reopen() {
 	}
 }
 
+func (ms *Modules) upgrade() {
+	if ms.exiting {
+		return
+	}
+
+	if ms.upgrading != nil {
+		ms.log.LogError(ms, "upgrading, new process %d",
+			ms.upgrading.Process.Pid)
+		return
+	}
+
+	ms.log.LogError(ms, "upgrade ...")
+
+	var pidfile *os.File
+	if ms.pidfile != nil {
+		pidfile = ms.pidfile.file
+	}
+
+	cmd, err := startUpgrade(pidfile)
+	if err != nil {
+		ms.log.LogError(ms, "upgrade failed: %s", err.Error())
+		return
+	}
+
+	ms.upgrading = cmd
+	ms.log.LogError(ms, "new process %d started", cmd.Process.Pid)
+
+	// new process exit before old process exit, upgrade failed
+	go func() {
+		err := cmd.Wait()
+
+		ms.call(func() {
+			ms.log.LogError(ms, "new process %d exit: %v",
+				cmd.Process.Pid, err)
+			ms.upgrading = nil
+		})
+	}()
+}
+
+func (ms *Modules) closeInherited(interface{}) {
+	for _, addr := range closeInherited() {
+		ms.log.LogError(ms, "inherited listener %s not claimed, closed", addr)
+	}
+}
+
 func (ms *Modules) exit() {
+	if ms.exiting {
+		return
+	}
+
 	ms.log.LogError(ms, "exiting ...")
 
-	for name, mctx := range ms.modules {
-		mctx.timer = NewTimer(5*time.Second, ms.closeTimeout, name)
-		mctx.m.Exit()
+	ms.exiting = true
+	if ms.shutdownTimeout > 0 {
+		ms.shutdownTimer = NewTimer(ms.shutdownTimeout, ms.closeAllTimeout,
+			nil)
+	}
+
+	for i := len(ms.callseq) - 1; i >= 0; i-- {
+		name := ms.callseq[i]
+		ms.cancelRestart(ms.modules[name])
+		ms.exitseq = append(ms.exitseq, name)
 	}
+
+	ms.exitNext()
+}
+
+// Call Exit of modules in exitseq one by one, a module will not exit until
+// all modules depend on it have exited
+func (ms *Modules) exitNext() {
+	for len(ms.exitseq) > 0 {
+		mctx := ms.modules[ms.exitseq[0]]
+
+		// module has been unloaded
+		if mctx == nil {
+			ms.exitseq = ms.exitseq[1:]
+			continue
+		}
+
+		if mctx.closed {
+			ctx, cancel := ms.exitContext(mctx.name)
+			mctx.m.Exit(ctx)
+			cancel()
+
+			ms.exitseq = ms.exitseq[1:]
+			continue
+		}
+
+		// module is unloading, wait for its mainloop return
+		if mctx.unloaded == nil {
+			ms.exitModule(mctx)
+		}
+
+		return
+	}
+}
+
+// Call Exit of module, and wait for module mainloop return, see close
+func (ms *Modules) exitModule(mctx *modulectx) {
+	ctx, cancel := ms.exitContext(mctx.name)
+
+	mctx.timer = nil
+	if timeout := ms.exitTimeoutOf(mctx.name); timeout > 0 {
+		mctx.timer = NewTimer(timeout, ms.closeTimeout, mctx)
+	}
+	mctx.exitCancel = cancel
+	mctx.cancel()
+	ms.setState(mctx, ModuleDraining)
+
+	mctx.m.Exit(ctx)
+}
+
+// Report modules failed to stop in time with their mainloop stacks
+func (ms *Modules) report() {
+	var stacks []byte
+
+	for _, name := range ms.callseq {
+		mctx := ms.modules[name]
+		if mctx.closed && !mctx.timedout {
+			continue
+		}
+
+		ms.forced = true
+
+		if stacks == nil {
+			stacks = allStacks()
+		}
+
+		stack := goroutineStack(stacks, atomic.LoadUint64(&mctx.gid))
+		if stack == nil {
+			ms.log.LogError(ms, "module %s failed to stop in time", name)
+			continue
+		}
+
+		ms.log.LogError(ms, "module %s failed to stop in time, stack:\n%s",
+			name, stack)
+	}
+}
+
+// Get current goroutine id
+func goroutineId() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+
+	// goroutine 18 [running]:
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	buf = buf[:bytes.IndexByte(buf, ' ')]
+
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+
+	return id
+}
+
+// Get stacks of all goroutines
+func allStacks() []byte {
+	buf := make([]byte, 64*1024)
+
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// Get stack of goroutine whose id is gid in stacks, nil if not found
+func goroutineStack(stacks []byte, gid uint64) []byte {
+	prefix := []byte("goroutine " + strconv.FormatUint(gid, 10) + " [")
+
+	for _, stack := range bytes.Split(stacks, []byte("\n\n")) {
+		if bytes.HasPrefix(stack, prefix) {
+			return stack
+		}
+	}
+
+	return nil
 }
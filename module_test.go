@@ -0,0 +1,832 @@
+package golib_test
+
+import (
+	"context"
+	"fmt"
+	"golib"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var moduleLog = filepath.Join(os.TempDir(), "golib_module_test.log")
+
+type events struct {
+	list []string
+	lock sync.Mutex
+}
+
+func (e *events) add(format string, v ...interface{}) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.list = append(e.list, fmt.Sprintf(format, v...))
+}
+
+func (e *events) String() string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return strings.Join(e.list, ",")
+}
+
+type testModule struct {
+	name   string
+	events *events
+	quit   chan bool
+}
+
+func newTestModule(name string, e *events) *testModule {
+	return &testModule{
+		name:   name,
+		events: e,
+		quit:   make(chan bool),
+	}
+}
+
+func (m *testModule) PreInit() error {
+	m.events.add("%s.preinit", m.name)
+	return nil
+}
+
+func (m *testModule) Init() error {
+	m.events.add("%s.init", m.name)
+	return nil
+}
+
+func (m *testModule) PreMainloop() error {
+	m.events.add("%s.premainloop", m.name)
+	return nil
+}
+
+func (m *testModule) Mainloop() {
+	<-m.quit
+	m.events.add("%s.mainloop", m.name)
+}
+
+func (m *testModule) Exit() {
+	m.events.add("%s.exit", m.name)
+	close(m.quit)
+}
+
+type testFailedModule struct {
+	testModule
+}
+
+func (m *testFailedModule) Init() error {
+	return fmt.Errorf("init failed")
+}
+
+type testCtxModule struct {
+	events *events
+}
+
+func (m *testCtxModule) PreInit(ctx context.Context) error {
+	return nil
+}
+
+func (m *testCtxModule) Init(ctx context.Context) error {
+	return nil
+}
+
+func (m *testCtxModule) PreMainloop(ctx context.Context) error {
+	return nil
+}
+
+func (m *testCtxModule) Mainloop(ctx context.Context) {
+	<-ctx.Done()
+	m.events.add("ctx.mainloop")
+}
+
+func (m *testCtxModule) Exit(ctx context.Context) {
+	if _, ok := ctx.Deadline(); ok {
+		m.events.add("ctx.exit")
+	}
+}
+
+type testReloader struct {
+	events *events
+}
+
+func (r *testReloader) Reload() error {
+	r.events.add("reload")
+	return nil
+}
+
+// Start ms in a goroutine, wait until all modules running
+func startModules(t *testing.T, ms *golib.Modules) chan bool {
+	done := make(chan bool)
+
+	go func() {
+		if err := ms.Start(); err != nil {
+			t.Error("start failed:", err)
+		}
+		close(done)
+	}()
+
+	for i := 0; !ms.Ready(); i++ {
+		if i == 100 {
+			t.Fatal("modules not ready")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return done
+}
+
+func waitModules(t *testing.T, done chan bool) {
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("modules not exit")
+	}
+}
+
+func TestModulesLifecycle(t *testing.T) {
+	e := &events{}
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.AddModule("http", newTestModule("http", e), "db")
+	ms.AddModule("db", newTestModule("db", e))
+
+	done := startModules(t, ms)
+	ms.Stop()
+	waitModules(t, done)
+
+	expect := "db.preinit,http.preinit,db.init,http.init," +
+		"db.premainloop,http.premainloop," +
+		"http.exit,http.mainloop,db.exit,db.mainloop"
+	if e.String() != expect {
+		t.Error("lifecycle error, expect:", expect, "get:", e.String())
+	}
+}
+
+func TestModulesSignal(t *testing.T) {
+	e := &events{}
+	signals := make(chan os.Signal)
+
+	name := fmt.Sprintf("TestModulesSignal%d", time.Now().UnixNano())
+	golib.AddReloader(name, &testReloader{events: e})
+	defer golib.RemoveReloader(name)
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(signals)
+	ms.AddContextModule("ctx", &testCtxModule{events: e})
+
+	done := startModules(t, ms)
+	signals <- syscall.SIGHUP
+	ms.Reload()
+	signals <- syscall.SIGINT
+	waitModules(t, done)
+
+	expect := "reload,reload,ctx."
+	if !strings.HasPrefix(e.String(), expect) ||
+		!strings.Contains(e.String(), "ctx.mainloop") ||
+		!strings.Contains(e.String(), "ctx.exit") {
+
+		t.Error("signal error, expect:", expect, "get:", e.String())
+	}
+}
+
+func TestModulesHealth(t *testing.T) {
+	e := &events{}
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.AddModule("m", newTestModule("m", e))
+
+	done := startModules(t, ms)
+
+	w := httptest.NewRecorder()
+	ms.HealthHandler(w, httptest.NewRequest("GET", "/health/ready", nil))
+	if w.Code != http.StatusOK {
+		t.Error("ready error, expect:", http.StatusOK, "get:", w.Code)
+	}
+	fmt.Println(w.Body.String())
+
+	ms.Stop()
+	waitModules(t, done)
+
+	w = httptest.NewRecorder()
+	ms.HealthHandler(w, httptest.NewRequest("GET", "/health/live", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Error("live error, expect:", http.StatusServiceUnavailable,
+			"get:", w.Code)
+	}
+	fmt.Println(w.Body.String())
+}
+
+func TestModulesInitFailed(t *testing.T) {
+	e := &events{}
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.AddModule("a", newTestModule("a", e))
+	ms.AddModule("b", newTestModule("b", e))
+	ms.AddModule("c", &testFailedModule{*newTestModule("c", e)}, "a", "b")
+
+	err := ms.Start()
+	fmt.Println(err)
+
+	merr, ok := err.(*golib.ModuleError)
+	if !ok || merr.Module != "c" || merr.Phase != "Init" {
+		t.Error("start error, expect: c Init error", "get:", err)
+	}
+
+	expect := "a.preinit,b.preinit,c.preinit,a.init,b.init,b.exit,a.exit"
+	if e.String() != expect {
+		t.Error("rollback error, expect:", expect, "get:", e.String())
+	}
+}
+
+func TestModulesDependencyCycle(t *testing.T) {
+	e := &events{}
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.AddModule("a", newTestModule("a", e), "b")
+	ms.AddModule("b", newTestModule("b", e), "a")
+
+	err := ms.Start()
+	fmt.Println(err)
+
+	merr, ok := err.(*golib.ModuleError)
+	if !ok || merr.Phase != "dependency" {
+		t.Error("start error, expect: dependency error", "get:", err)
+	}
+}
+
+func TestModulesLoad(t *testing.T) {
+	e := &events{}
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.AddModule("a", newTestModule("a", e))
+
+	err := ms.LoadModule("b", newTestModule("b", e), "a")
+	if err == nil {
+		t.Error("load module before start successd")
+	}
+
+	done := startModules(t, ms)
+
+	err = ms.LoadModule("b", newTestModule("b", e), "c")
+	if err == nil {
+		t.Error("load module depends on unavailable module successd")
+	}
+	fmt.Println(err)
+
+	err = ms.LoadModule("b", newTestModule("b", e), "a")
+	if err != nil {
+		t.Error("load module failed:", err)
+	}
+
+	health := ms.Health()
+	if len(health.Modules) != 2 || !health.Ready {
+		t.Error("load module error, health:", health)
+	}
+
+	err = ms.UnloadModule("a")
+	if err == nil {
+		t.Error("unload module depended by other module successd")
+	}
+	fmt.Println(err)
+
+	err = ms.UnloadModule("b")
+	if err != nil {
+		t.Error("unload module failed:", err)
+	}
+
+	health = ms.Health()
+	if len(health.Modules) != 1 || health.Modules[0].Name != "a" {
+		t.Error("unload module error, health:", health)
+	}
+
+	ms.Stop()
+	waitModules(t, done)
+
+	expect := "a.preinit,a.init,a.premainloop," +
+		"b.preinit,b.init,b.premainloop,b.exit,b.mainloop," +
+		"a.exit,a.mainloop"
+	if e.String() != expect {
+		t.Error("load error, expect:", expect, "get:", e.String())
+	}
+}
+
+func TestModulesSignalHandler(t *testing.T) {
+	e := &events{}
+	signals := make(chan os.Signal)
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(signals)
+	ms.AddModule("m", newTestModule("m", e))
+
+	ms.HandleSignal(syscall.SIGUSR2, func(s os.Signal) {
+		e.add("usr2")
+		ms.Reopen()
+	})
+	ms.HandleSignal(syscall.SIGHUP, nil)
+	ms.HandleSignal(syscall.SIGINT, func(s os.Signal) {
+		e.add("int")
+		ms.Stop()
+	})
+
+	done := startModules(t, ms)
+	signals <- syscall.SIGUSR2
+	signals <- syscall.SIGHUP
+	signals <- syscall.SIGINT
+	waitModules(t, done)
+
+	expect := "m.preinit,m.init,m.premainloop,usr2,int,m.exit,m.mainloop"
+	if e.String() != expect {
+		t.Error("signal handler error, expect:", expect, "get:", e.String())
+	}
+}
+
+func TestModulesPidFile(t *testing.T) {
+	e := &events{}
+	pidfile := filepath.Join(os.TempDir(), "golib_module_test.pid")
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.SetPidFile(pidfile)
+	ms.AddModule("m", newTestModule("m", e))
+
+	done := startModules(t, ms)
+
+	another := golib.NewModuleManager()
+	another.SetLog(moduleLog, golib.LOGDEBUG)
+	another.SetSignalSource(make(chan os.Signal))
+	another.SetPidFile(pidfile)
+
+	err := another.Start()
+	fmt.Println(err)
+
+	merr, ok := err.(*golib.ModuleError)
+	if !ok || merr.Phase != "pidfile" {
+		t.Error("start error, expect: pidfile error", "get:", err)
+	}
+
+	if err := golib.SignalProcess(pidfile, "unknown"); err == nil {
+		t.Error("send unknown signal successd")
+	}
+
+	ms.Stop()
+	waitModules(t, done)
+
+	if _, err := os.Stat(pidfile); !os.IsNotExist(err) {
+		t.Error("pid file not removed:", err)
+	}
+
+	if err := golib.SignalProcess(pidfile, "reload"); err == nil {
+		t.Error("send signal to exited process successd")
+	}
+}
+
+// Module ignores its ctx, mainloop returns only after release closed
+type testHangModule struct {
+	release chan bool
+}
+
+func (m *testHangModule) PreInit(ctx context.Context) error {
+	return nil
+}
+
+func (m *testHangModule) Init(ctx context.Context) error {
+	return nil
+}
+
+func (m *testHangModule) PreMainloop(ctx context.Context) error {
+	return nil
+}
+
+func (m *testHangModule) Mainloop(ctx context.Context) {
+	<-m.release
+}
+
+func (m *testHangModule) Exit(ctx context.Context) {
+}
+
+// Start ms in a goroutine, wait until all modules running, error returned
+// by Start is sent into the channel returned
+func runModules(t *testing.T, ms *golib.Modules) chan error {
+	errc := make(chan error, 1)
+
+	go func() {
+		errc <- ms.Start()
+	}()
+
+	for i := 0; !ms.Ready(); i++ {
+		if i == 100 {
+			t.Fatal("modules not ready")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return errc
+}
+
+// Wait Start returning ErrForcedExit no later than within
+func waitForcedExit(t *testing.T, errc chan error, within time.Duration) {
+	select {
+	case err := <-errc:
+		if err != golib.ErrForcedExit {
+			t.Error("exit error, expect:", golib.ErrForcedExit, "get:", err)
+		}
+	case <-time.After(within):
+		t.Fatal("modules not exit in", within)
+	}
+}
+
+func TestModulesExitTimeout(t *testing.T) {
+	m := &testHangModule{release: make(chan bool)}
+	defer close(m.release)
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.SetExitTimeout(100*time.Millisecond, 0)
+	ms.AddContextModule("hang", m)
+
+	errc := runModules(t, ms)
+	ms.Stop()
+	waitForcedExit(t, errc, time.Second)
+}
+
+func TestModulesNoExitTimeout(t *testing.T) {
+	m := &testHangModule{release: make(chan bool)}
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.SetExitTimeout(time.Minute, 0)
+	ms.SetModuleExitTimeout("hang", 0)
+	ms.AddContextModule("hang", m)
+
+	errc := runModules(t, ms)
+	ms.Stop()
+
+	// module drains in 50ms, 0 means no limit
+	time.Sleep(50 * time.Millisecond)
+	close(m.release)
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Error("exit error, expect: nil get:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("modules not exit")
+	}
+}
+
+func TestModulesModuleExitTimeout(t *testing.T) {
+	e := &events{}
+	m := &testHangModule{release: make(chan bool)}
+	defer close(m.release)
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.SetExitTimeout(time.Minute, 0)
+	ms.SetModuleExitTimeout("hang", 100*time.Millisecond)
+	ms.AddContextModule("hang", m)
+	ms.AddModule("m", newTestModule("m", e))
+
+	errc := runModules(t, ms)
+	ms.Stop()
+	waitForcedExit(t, errc, time.Second)
+
+	// modules not timed out exit normally
+	expect := "m.preinit,m.init,m.premainloop,m.exit,m.mainloop"
+	if e.String() != expect {
+		t.Error("exit error, expect:", expect, "get:", e.String())
+	}
+}
+
+func TestModulesShutdownTimeout(t *testing.T) {
+	m := &testHangModule{release: make(chan bool)}
+	defer close(m.release)
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.SetExitTimeout(time.Minute, 100*time.Millisecond)
+	ms.AddContextModule("hang", m)
+
+	errc := runModules(t, ms)
+	ms.Stop()
+	waitForcedExit(t, errc, time.Second)
+}
+
+func TestModulesForceStop(t *testing.T) {
+	m := &testHangModule{release: make(chan bool)}
+	defer close(m.release)
+
+	signals := make(chan os.Signal)
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(signals)
+	ms.SetExitTimeout(time.Minute, time.Minute)
+	ms.AddContextModule("hang", m)
+
+	errc := runModules(t, ms)
+	signals <- syscall.SIGINT
+	signals <- syscall.SIGINT
+	waitForcedExit(t, errc, time.Second)
+}
+
+// Module mainloop panics in the first panics runs, then waits for ctx done
+type testPanicModule struct {
+	panics int
+
+	runs []time.Time
+	lock sync.Mutex
+}
+
+func (m *testPanicModule) PreInit(ctx context.Context) error {
+	return nil
+}
+
+func (m *testPanicModule) Init(ctx context.Context) error {
+	return nil
+}
+
+func (m *testPanicModule) PreMainloop(ctx context.Context) error {
+	return nil
+}
+
+func (m *testPanicModule) Mainloop(ctx context.Context) {
+	m.lock.Lock()
+	m.runs = append(m.runs, time.Now())
+	n := len(m.runs)
+	m.lock.Unlock()
+
+	if n <= m.panics {
+		panic(fmt.Sprintf("panic %d", n))
+	}
+
+	<-ctx.Done()
+}
+
+func (m *testPanicModule) Exit(ctx context.Context) {
+}
+
+func (m *testPanicModule) startTimes() []time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return append([]time.Time{}, m.runs...)
+}
+
+// Wait until module name of ms in state
+func waitModuleState(t *testing.T, ms *golib.Modules, name string,
+	state golib.ModuleState) {
+
+	for i := 0; ; i++ {
+		for _, mh := range ms.Health().Modules {
+			if mh.Name == name && mh.State == state.String() {
+				return
+			}
+		}
+
+		if i == 100 {
+			t.Fatal("module", name, "not", state, "health:", ms.Health())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestModulesRestart(t *testing.T) {
+	m := &testPanicModule{panics: 2}
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.SetRestartPolicy("m", golib.RestartPolicy{
+		Policy:  golib.RestartOnFailure,
+		Backoff: 10 * time.Millisecond,
+	})
+	ms.AddContextModule("m", m)
+
+	done := startModules(t, ms)
+
+	for i := 0; len(m.startTimes()) < 3; i++ {
+		if i == 100 {
+			t.Fatal("module not restarted, runs:", len(m.startTimes()))
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitModuleState(t, ms, "m", golib.ModuleRunning)
+
+	ms.Stop()
+	waitModules(t, done)
+
+	if runs := len(m.startTimes()); runs != 3 {
+		t.Error("restart error, expect: 3 runs", "get:", runs)
+	}
+}
+
+func TestModulesMaxRestarts(t *testing.T) {
+	m := &testPanicModule{panics: 10}
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.SetRestartPolicy("m", golib.RestartPolicy{
+		Policy:      golib.RestartOnFailure,
+		MaxRestarts: 2,
+		Backoff:     10 * time.Millisecond,
+	})
+	ms.AddContextModule("m", m)
+
+	// module manager exits after its only module dead
+	if err := ms.Start(); err != nil {
+		t.Error("start failed:", err)
+	}
+
+	if runs := len(m.startTimes()); runs != 3 {
+		t.Error("max restarts error, expect: 3 runs", "get:", runs)
+	}
+
+	mh := ms.Health().Modules[0]
+	if mh.State != golib.ModuleDead.String() {
+		t.Error("max restarts error, expect: dead", "get:", mh.State)
+	}
+}
+
+func TestModulesRestartBackoff(t *testing.T) {
+	backoff := 20 * time.Millisecond
+	maxBackoff := 50 * time.Millisecond
+
+	m := &testPanicModule{panics: 10}
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.SetRestartPolicy("m", golib.RestartPolicy{
+		Policy:      golib.RestartOnFailure,
+		MaxRestarts: 5,
+		Backoff:     backoff,
+		MaxBackoff:  maxBackoff,
+	})
+	ms.AddContextModule("m", m)
+
+	if err := ms.Start(); err != nil {
+		t.Error("start failed:", err)
+	}
+
+	// backoff 20ms, 40ms, then capped at 50ms, uncapped would be 320ms
+	runs := m.startTimes()
+	if len(runs) != 6 {
+		t.Fatal("backoff error, expect: 6 runs", "get:", len(runs))
+	}
+
+	for i := 1; i < len(runs); i++ {
+		d := runs[i].Sub(runs[i-1])
+		if d < backoff || d > maxBackoff+100*time.Millisecond {
+			t.Error("backoff error, restart", i, "after", d)
+		}
+	}
+
+	if d := runs[5].Sub(runs[4]); d < maxBackoff {
+		t.Error("backoff error, expect at least:", maxBackoff, "get:", d)
+	}
+}
+
+func TestModulesStopRestarting(t *testing.T) {
+	e := &events{}
+	m := &testPanicModule{panics: 1}
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.SetRestartPolicy("a", golib.RestartPolicy{
+		Policy:  golib.RestartOnFailure,
+		Backoff: time.Minute,
+	})
+	ms.AddContextModule("a", m)
+	ms.AddModule("b", newTestModule("b", e))
+
+	// not ready while a restarting, wait a restarting instead
+	errc := make(chan error, 1)
+	go func() {
+		errc <- ms.Start()
+	}()
+	waitModuleState(t, ms, "a", golib.ModuleRestarting)
+
+	ms.Stop()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Error("start failed:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("modules not exit")
+	}
+
+	// module manager waits for b exiting, nModule decremented once for a
+	expect := "b.preinit,b.init,b.premainloop,b.exit,b.mainloop"
+	if e.String() != expect {
+		t.Error("stop restarting error, expect:", expect, "get:", e.String())
+	}
+
+	if runs := len(m.startTimes()); runs != 1 {
+		t.Error("stop restarting error, expect: 1 run", "get:", runs)
+	}
+
+	for _, mh := range ms.Health().Modules {
+		if mh.State != golib.ModuleDead.String() {
+			t.Error("stop restarting error, module", mh.Name, mh.State)
+		}
+	}
+}
+
+// Reloader calls Reload of module manager
+type testReentrantReloader struct {
+	ms     *golib.Modules
+	events *events
+}
+
+func (r *testReentrantReloader) Reload() error {
+	r.events.add("reload")
+	r.ms.Reload()
+	return nil
+}
+
+func TestModulesReloadInReloader(t *testing.T) {
+	e := &events{}
+	signals := make(chan os.Signal)
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(signals)
+	ms.AddModule("m", newTestModule("m", e))
+
+	name := fmt.Sprintf("TestModulesReloadInReloader%d", time.Now().UnixNano())
+	golib.AddReloader(name, &testReentrantReloader{ms: ms, events: e})
+	defer golib.RemoveReloader(name)
+
+	done := startModules(t, ms)
+	signals <- syscall.SIGHUP
+	ms.Reload()
+	ms.Stop()
+	waitModules(t, done)
+
+	expect := "m.preinit,m.init,m.premainloop,reload,reload,m.exit,m.mainloop"
+	if e.String() != expect {
+		t.Error("reload in reloader error, expect:", expect,
+			"get:", e.String())
+	}
+}
+
+func TestModulesUnloadInHandler(t *testing.T) {
+	e := &events{}
+	signals := make(chan os.Signal)
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(signals)
+	ms.AddModule("a", newTestModule("a", e))
+	ms.AddModule("b", newTestModule("b", e))
+
+	ms.HandleSignal(syscall.SIGUSR2, func(s os.Signal) {
+		if err := ms.UnloadModule("b"); err != nil {
+			t.Error("unload module failed:", err)
+		}
+	})
+
+	done := startModules(t, ms)
+	signals <- syscall.SIGUSR2
+	ms.Stop()
+	waitModules(t, done)
+
+	expect := "a.preinit,b.preinit,a.init,b.init," +
+		"a.premainloop,b.premainloop,b.exit,b.mainloop," +
+		"a.exit,a.mainloop"
+	if e.String() != expect {
+		t.Error("unload in handler error, expect:", expect,
+			"get:", e.String())
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib module health
+
+package golib
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Module state
+type ModuleState int
+
+// Module state const definition
+const (
+	ModuleInitializing ModuleState = iota
+	ModuleRunning
+	ModuleDraining
+	ModuleDead
+	ModuleRestarting
+)
+
+var moduleStates = []string{
+	"initializing",
+	"running",
+	"draining",
+	"dead",
+	"restarting",
+}
+
+// Convert ModuleState to string
+func (s ModuleState) String() string {
+	return moduleStates[s]
+}
+
+// HealthChecker interface, Module or ContextModule could implement it
+// to report whether it is healthy
+type HealthChecker interface {
+	// Return nil if module is healthy
+	Health() error
+}
+
+// Health of a module
+type ModuleHealth struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	Alive bool   `json:"alive"`
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// Health of all modules in module manager
+type ModulesHealth struct {
+	Alive   bool           `json:"alive"`
+	Ready   bool           `json:"ready"`
+	Modules []ModuleHealth `json:"modules"`
+}
+
+func (ms *Modules) setState(mctx *modulectx, state ModuleState) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	mctx.state = state
+}
+
+func (mctx *modulectx) healthChecker() HealthChecker {
+	if a, ok := mctx.m.(*moduleAdapter); ok {
+		hc, _ := a.m.(HealthChecker)
+		return hc
+	}
+
+	hc, _ := mctx.m.(HealthChecker)
+	return hc
+}
+
+// Get health of all modules, a module is alive if it is not dead and its
+// health check passed, a module is ready if it is running and its health
+// check passed
+func (ms *Modules) Health() *ModulesHealth {
+	type check struct {
+		name  string
+		state ModuleState
+		hc    HealthChecker
+	}
+
+	ms.lock.RLock()
+	checks := make([]check, 0, len(ms.callseq))
+	for _, name := range ms.callseq {
+		mctx := ms.modules[name]
+		checks = append(checks, check{name, mctx.state, mctx.healthChecker()})
+	}
+	ms.lock.RUnlock()
+
+	health := &ModulesHealth{
+		Alive:   true,
+		Ready:   true,
+		Modules: make([]ModuleHealth, 0, len(checks)),
+	}
+
+	// health check may block, call it without lock
+	for _, c := range checks {
+		mh := ModuleHealth{
+			Name:  c.name,
+			State: c.state.String(),
+			Alive: c.state != ModuleDead,
+			Ready: c.state == ModuleRunning,
+		}
+
+		if c.hc != nil {
+			if err := c.hc.Health(); err != nil {
+				mh.Alive = false
+				mh.Ready = false
+				mh.Error = err.Error()
+			}
+		}
+
+		health.Alive = health.Alive && mh.Alive
+		health.Ready = health.Ready && mh.Ready
+		health.Modules = append(health.Modules, mh)
+	}
+
+	return health
+}
+
+// Return true if all modules are alive
+func (ms *Modules) Alive() bool {
+	return ms.Health().Alive
+}
+
+// Return true if all modules are ready
+func (ms *Modules) Ready() bool {
+	return ms.Health().Ready
+}
+
+// HTTP handler for health probe, could be used as handle of HTTPServer.
+// Response health of all modules in json, if request path ends with "/live"
+// or "/ready", response status is 503 when modules are not alive or not
+// ready, otherwise is 200
+func (ms *Modules) HealthHandler(w http.ResponseWriter, req *http.Request) {
+	health := ms.Health()
+
+	status := http.StatusOK
+	if strings.HasSuffix(req.URL.Path, "/live") && !health.Alive {
+		status = http.StatusServiceUnavailable
+	}
+
+	if strings.HasSuffix(req.URL.Path, "/ready") && !health.Ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	body, _ := json.Marshal(health)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
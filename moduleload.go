@@ -0,0 +1,204 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib module dynamic load
+
+package golib
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Load User Module into running module manager, deps are names of running
+// modules m depends on. PreInit, Init and PreMainloop of m will be called
+// in order, then m's Mainloop will be started.
+// If a dead module has the same name, it will be replaced
+func (ms *Modules) LoadModule(name string, m Module, deps ...string) error {
+	return ms.LoadContextModule(name, &moduleAdapter{m: m}, deps...)
+}
+
+// Load User ContextModule into running module manager, same as LoadModule
+func (ms *Modules) LoadContextModule(name string, m ContextModule,
+	deps ...string) error {
+
+	mctx := &modulectx{
+		name: name,
+		m:    m,
+		deps: deps,
+	}
+
+	var err error
+
+	if !ms.isRunning() || !ms.call(func() { err = ms.load(mctx) }) {
+		return fmt.Errorf("module manager not running")
+	}
+
+	return err
+}
+
+// Exit module whose name is name and remove it from running module manager,
+// return after module mainloop returned or exit timeout. If called in
+// signal handlers or functions called in mainloop, return after unload
+// scheduled, as mainloop could not wait for itself.
+// Module depended by other running modules could not be unloaded.
+// If no module left after unload, module manager will exit
+func (ms *Modules) UnloadModule(name string) error {
+	var (
+		unloaded chan bool
+		err      error
+	)
+
+	if !ms.isRunning() ||
+		!ms.call(func() { unloaded, err = ms.unload(name) }) {
+
+		return fmt.Errorf("module manager not running")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if atomic.LoadUint64(&ms.gid) == goroutineId() {
+		return nil
+	}
+
+	select {
+	case <-unloaded:
+	case <-ms.quit:
+	}
+
+	return nil
+}
+
+func (ms *Modules) isRunning() bool {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
+	return ms.running
+}
+
+func (ms *Modules) load(mctx *modulectx) error {
+	name := mctx.name
+
+	if ms.exiting {
+		return fmt.Errorf("module manager exiting")
+	}
+
+	old, ok := ms.modules[name]
+	if ok && !old.closed {
+		return fmt.Errorf("module %s exists", name)
+	}
+
+	for _, dep := range mctx.deps {
+		d, ok := ms.modules[dep]
+		if !ok || d.closed {
+			return fmt.Errorf("module %s depends on unavailable module %s",
+				name, dep)
+		}
+	}
+
+	if ok {
+		ms.remove(old)
+	}
+
+	ms.lock.Lock()
+	ms.modules[name] = mctx
+	ms.callseq = append(ms.callseq, name)
+	ms.lock.Unlock()
+
+	if err := mctx.m.PreInit(ms.ctx); err != nil {
+		ms.remove(mctx)
+		return &ModuleError{Module: name, Phase: "PreInit", Err: err}
+	}
+
+	if err := mctx.m.Init(ms.ctx); err != nil {
+		ms.remove(mctx)
+		return &ModuleError{Module: name, Phase: "Init", Err: err}
+	}
+
+	if err := mctx.m.PreMainloop(ms.ctx); err != nil {
+		ms.rollback([]string{name})
+		ms.remove(mctx)
+		return &ModuleError{Module: name, Phase: "PreMainloop", Err: err}
+	}
+
+	ms.log.LogInfo(ms, "module %s loaded", name)
+
+	ms.nModule++
+	ms.launch(mctx)
+
+	return nil
+}
+
+func (ms *Modules) unload(name string) (chan bool, error) {
+	if ms.exiting {
+		return nil, fmt.Errorf("module manager exiting")
+	}
+
+	mctx, ok := ms.modules[name]
+	if !ok {
+		return nil, fmt.Errorf("module %s not exist", name)
+	}
+
+	if mctx.unloaded != nil {
+		return mctx.unloaded, nil
+	}
+
+	for _, n := range ms.callseq {
+		m := ms.modules[n]
+		if m.closed {
+			continue
+		}
+
+		for _, dep := range m.deps {
+			if dep == name {
+				return nil, fmt.Errorf("module %s is depended by %s", name, n)
+			}
+		}
+	}
+
+	ms.log.LogInfo(ms, "module %s unloading", name)
+
+	mctx.unloaded = make(chan bool)
+	ms.cancelRestart(mctx)
+
+	if !mctx.closed {
+		// module will be removed after mainloop return, see close
+		ms.exitModule(mctx)
+		return mctx.unloaded, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		ms.exitTimeoutOf(name))
+	mctx.m.Exit(ctx)
+	cancel()
+
+	ms.remove(mctx)
+
+	return mctx.unloaded, nil
+}
+
+// Remove module from module manager
+func (ms *Modules) remove(mctx *modulectx) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.modules[mctx.name] != mctx {
+		return
+	}
+
+	delete(ms.modules, mctx.name)
+
+	for i, name := range ms.callseq {
+		if name == mctx.name {
+			ms.callseq = append(ms.callseq[:i:i], ms.callseq[i+1:]...)
+			break
+		}
+	}
+
+	if mctx.unloaded != nil {
+		close(mctx.unloaded)
+		ms.log.LogInfo(ms, "module %s unloaded", mctx.name)
+	}
+}
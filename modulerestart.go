@@ -0,0 +1,132 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib module restart
+
+package golib
+
+import (
+	"time"
+)
+
+// Module restart policy const definition
+const (
+	// Never restart module mainloop
+	RestartNever = iota
+
+	// Restart module mainloop only if it panics
+	RestartOnFailure
+
+	// Restart module mainloop whenever it panics or returns
+	RestartAlways
+)
+
+// Default restart backoff
+const (
+	restartBackoff    = time.Second
+	restartMaxBackoff = time.Minute
+)
+
+// Module restart policy, module mainloop will be restarted after backoff
+// when it returns or panics as Policy, backoff will double after each
+// restart until reach MaxBackoff
+type RestartPolicy struct {
+	// RestartNever, RestartOnFailure or RestartAlways
+	Policy int
+
+	// Max restart times, 0 means no limit
+	MaxRestarts int
+
+	// Delay before first restart, default is 1s
+	Backoff time.Duration
+
+	// Max delay before restart, default is 1m
+	MaxBackoff time.Duration
+}
+
+// Set restart policy for module whose name is name,
+// default policy is RestartNever
+func (ms *Modules) SetRestartPolicy(name string, policy RestartPolicy) {
+	if policy.Backoff <= 0 {
+		policy.Backoff = restartBackoff
+	}
+
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = restartMaxBackoff
+	}
+
+	ms.restartPolicies[name] = policy
+}
+
+// Delay before restart module which has restarted restarts times
+func (p *RestartPolicy) backoff(restarts int) time.Duration {
+	d := p.Backoff
+
+	for i := 0; i < restarts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	return d
+}
+
+// Schedule restart of module whose mainloop has returned or panicked,
+// return false if module should not restart
+func (ms *Modules) restart(mctx *modulectx) bool {
+	if ms.exiting || mctx.unloaded != nil {
+		return false
+	}
+
+	name := mctx.name
+
+	p, ok := ms.restartPolicies[name]
+	if !ok || p.Policy == RestartNever {
+		return false
+	}
+
+	if p.Policy == RestartOnFailure && !mctx.failed {
+		return false
+	}
+
+	if p.MaxRestarts > 0 && mctx.restarts >= p.MaxRestarts {
+		ms.log.LogError(ms, "module %s exceed max restarts %d",
+			name, p.MaxRestarts)
+		return false
+	}
+
+	d := p.backoff(mctx.restarts)
+	mctx.restarts++
+
+	ms.log.LogError(ms, "module %s restart in %s, restarts: %d",
+		name, d, mctx.restarts)
+
+	mctx.restartTimer = NewTimer(d, ms.restartTimeout, mctx)
+	ms.setState(mctx, ModuleRestarting)
+
+	return true
+}
+
+func (ms *Modules) restartTimeout(m interface{}) {
+	select {
+	case ms.restartModule <- m.(*modulectx):
+	case <-ms.quit:
+	}
+}
+
+// Cancel restart of module, return false if module is not waiting restart
+func (ms *Modules) cancelRestart(mctx *modulectx) bool {
+	if mctx.restartTimer == nil {
+		return false
+	}
+
+	mctx.restartTimer.Stop()
+	mctx.restartTimer = nil
+
+	mctx.closed = true
+	ms.nModule--
+	ms.setState(mctx, ModuleDead)
+
+	return true
+}
@@ -6,7 +6,9 @@ package golib
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 )
 
 // Reloader interface
@@ -14,43 +16,410 @@ type Reloader interface {
 	Reload() error
 }
 
+// Transactional reloader interface, when reload, all reloaders will be
+// validated first, and committed only if all validations passed. If any
+// validation or commit failed, Rollback will be called for all validated
+// reloaders in reverse order
+type TxReloader interface {
+	// Prepare and check new config, new config should not take effect
+	Validate() error
+
+	// Make validated config take effect
+	Commit() error
+
+	// Discard validated config, restore config before Validate if it has
+	// been committed
+	Rollback()
+}
+
+// Adapter for Reloader, Reload will be called in Commit, and could not be
+// rolled back
+type reloaderAdapter struct {
+	r Reloader
+}
+
+func (a *reloaderAdapter) Validate() error {
+	return nil
+}
+
+func (a *reloaderAdapter) Commit() error {
+	return a.r.Reload()
+}
+
+func (a *reloaderAdapter) Rollback() {
+}
+
+// Reloader info for diagnostics
+type ReloaderInfo struct {
+	Name     string
+	Priority int
+	Deps     []string
+
+	// Time of last reload, zero if never reloaded
+	LastReload time.Time
+
+	// Error of last reload, nil if last reload successd
+	LastError error
+}
+
+type reloaderctx struct {
+	name     string
+	r        TxReloader
+	priority int
+	deps     []string
+	last     time.Time
+	err      error
+}
+
 var (
-	reloaderm     = make(map[string]Reloader)
+	reloaderm     = make(map[string]*reloaderctx)
+	reloaderseq   []string
 	reloadermLock sync.Mutex
 )
 
-// Register a reloader, if reloader has been loaded, do nothing
-func AddReloader(name string, r Reloader) {
+// Register a reloader, deps are names of reloaders r depends on, r will be
+// reloaded after them. deps could be registered later, r is skipped with an
+// error when reloading all while any of them is not registered. Return
+// error if name has been registered
+func AddReloader(name string, r Reloader, deps ...string) error {
+	return AddTxReloader(name, &reloaderAdapter{r: r}, deps...)
+}
+
+// Register a transactional reloader, same as AddReloader
+func AddTxReloader(name string, r TxReloader, deps ...string) error {
+	reloadermLock.Lock()
+	defer reloadermLock.Unlock()
+
+	if _, ok := reloaderm[name]; ok {
+		return fmt.Errorf("reloader %s has been registered", name)
+	}
+
+	reloaderm[name] = &reloaderctx{
+		name: name,
+		r:    r,
+		deps: deps,
+	}
+	reloaderseq = append(reloaderseq, name)
+
+	return nil
+}
+
+// Replace reloader registered as name with r, keep its priority and
+// dependencies
+func ReplaceReloader(name string, r Reloader) error {
+	return ReplaceTxReloader(name, &reloaderAdapter{r: r})
+}
+
+// Replace transactional reloader, same as ReplaceReloader
+func ReplaceTxReloader(name string, r TxReloader) error {
+	reloadermLock.Lock()
+	defer reloadermLock.Unlock()
+
+	rctx, ok := reloaderm[name]
+	if !ok {
+		return fmt.Errorf("%s not register as a Reloader", name)
+	}
+
+	rctx.r = r
+
+	return nil
+}
+
+// Unregister reloader whose name is name, reloader depended by other
+// reloaders could not be removed
+func RemoveReloader(name string) error {
 	reloadermLock.Lock()
 	defer reloadermLock.Unlock()
 
-	if _, ok := reloaderm[name]; ok { // reloader has been loaded
-		return
+	if _, ok := reloaderm[name]; !ok {
+		return fmt.Errorf("%s not register as a Reloader", name)
+	}
+
+	for _, n := range reloaderseq {
+		for _, dep := range reloaderm[n].deps {
+			if dep == name {
+				return fmt.Errorf("reloader %s is depended by %s", name, n)
+			}
+		}
+	}
+
+	delete(reloaderm, name)
+
+	for i, n := range reloaderseq {
+		if n == name {
+			reloaderseq = append(reloaderseq[:i:i], reloaderseq[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// Set priority of reloader whose name is name, reloaders with smaller
+// priority will be reloaded first if no dependency between them, default
+// priority is 0, reloaders with same priority reload in registration order
+func SetReloaderPriority(name string, priority int) error {
+	reloadermLock.Lock()
+	defer reloadermLock.Unlock()
+
+	rctx, ok := reloaderm[name]
+	if !ok {
+		return fmt.Errorf("%s not register as a Reloader", name)
+	}
+
+	rctx.priority = priority
+
+	return nil
+}
+
+// List all reloaders in reload order, reloaders depending on unknown
+// reloaders are listed at last
+func ListReloaders() ([]ReloaderInfo, error) {
+	reloadermLock.Lock()
+	defer reloadermLock.Unlock()
+
+	seq, broken, err := sortReloaders()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range broken {
+		seq = append(seq, e.name)
+	}
+
+	infos := make([]ReloaderInfo, 0, len(seq))
+	for _, n := range seq {
+		rctx := reloaderm[n]
+		infos = append(infos, ReloaderInfo{
+			Name:       n,
+			Priority:   rctx.priority,
+			Deps:       append([]string(nil), rctx.deps...),
+			LastReload: rctx.last,
+			LastError:  rctx.err,
+		})
 	}
 
-	reloaderm[name] = r
+	return infos, nil
 }
 
 // Call Reload whose name is name, if name is "", reload all reloaders
 func Reload(name string) error {
+	_, err := ReloadWithReport(name)
+
+	return err
+}
+
+// Same as Reload, return report of this reload, and error if reload failed.
+// Report is also recorded in reload history
+func ReloadWithReport(name string) (*ReloadReport, error) {
 	reloadermLock.Lock()
 	defer reloadermLock.Unlock()
 
+	report := &ReloadReport{
+		Name: name,
+		Time: time.Now(),
+	}
+
+	var err error
+
 	if name == "" {
-		for n, r := range reloaderm {
-			err := r.Reload()
-			if err != nil {
-				return fmt.Errorf("Reload %s failed, %s", n, err.Error())
+		seq, broken, serr := sortReloaders()
+		if serr != nil {
+			err = fmt.Errorf("Reload failed, %s", serr.Error())
+		} else {
+			err = reload(seq, report)
+			if berr := reloadBroken(broken, report); err == nil {
+				err = berr
+			}
+		}
+	} else if _, ok := reloaderm[name]; ok {
+		err = reload([]string{name}, report)
+	} else {
+		err = fmt.Errorf("%s not register as a Reloader", name)
+	}
+
+	report.Duration = time.Since(report.Time)
+	report.Success = err == nil
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	addReloadReport(report)
+
+	return report, err
+}
+
+// Sort reloaders by priority and dependency. Reloaders depending on unknown
+// reloaders, directly or indirectly, are left out of the order and returned
+// in broken, so they do not fail other reloaders
+func sortReloaders() ([]string, []*reloadError, error) {
+	names := append([]string(nil), reloaderseq...)
+	sort.SliceStable(names, func(i, j int) bool {
+		return reloaderm[names[i]].priority < reloaderm[names[j]].priority
+	})
+
+	errs := make(map[string]error)
+	for changed := true; changed; {
+		changed = false
+
+		for _, n := range names {
+			if errs[n] != nil {
+				continue
 			}
+
+			for _, dep := range reloaderm[n].deps {
+				if _, ok := reloaderm[dep]; !ok {
+					errs[n] = fmt.Errorf("depends on unknown %s", dep)
+				} else if errs[dep] != nil {
+					errs[n] = fmt.Errorf("depends on broken %s", dep)
+				}
+
+				if errs[n] != nil {
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	var (
+		valid  []string
+		broken []*reloadError
+	)
+
+	for _, n := range names {
+		if errs[n] != nil {
+			broken = append(broken, &reloadError{n, "dependency", errs[n]})
+		} else {
+			valid = append(valid, n)
+		}
+	}
+
+	seq, err := depSort(valid, func(name string) []string {
+		return reloaderm[name].deps
+	})
+
+	return seq, broken, err
+}
+
+// Record reloaders could not be reloaded for their dependencies in report,
+// return error of the first one
+func reloadBroken(broken []*reloadError, report *ReloadReport) error {
+	now := time.Now()
+	for _, e := range broken {
+		rctx := reloaderm[e.name]
+		rctx.last = now
+		rctx.err = e.err
+
+		report.Reloaders = append(report.Reloaders, ReloaderReport{
+			Name:  e.name,
+			Error: e.err.Error(),
+		})
+	}
+
+	if len(broken) == 0 {
+		return nil
+	}
+
+	return broken[0].toError()
+}
+
+// Validate all reloaders in names, then commit them in order, result of
+// each reloader is recorded in report
+func reload(names []string, report *ReloadReport) error {
+	durations := make(map[string]time.Duration)
+	err := reloadTx(names, durations)
+
+	now := time.Now()
+	for _, n := range names {
+		rctx := reloaderm[n]
+		rctx.last = now
+
+		switch {
+		case err == nil:
+			rctx.err = nil
+		case err.name == n:
+			rctx.err = err.err
+		default:
+			rctx.err = fmt.Errorf("rolled back as %s failed", err.name)
+		}
+
+		rr := ReloaderReport{
+			Name:     n,
+			Success:  rctx.err == nil,
+			Duration: durations[n],
 		}
 
+		if rctx.err != nil {
+			rr.Error = rctx.err.Error()
+		}
+
+		report.Reloaders = append(report.Reloaders, rr)
+	}
+
+	return err.toError()
+}
+
+type reloadError struct {
+	name  string
+	phase string
+	err   error
+}
+
+func (e *reloadError) toError() error {
+	if e == nil {
 		return nil
 	}
 
-	r, ok := reloaderm[name]
-	if ok {
-		return r.Reload()
+	return fmt.Errorf("Reload %s failed, %s error: %s",
+		e.name, e.phase, e.err.Error())
+}
+
+// Call f for reloader whose name is name, add time spent into durations
+func reloaderCall(name string, durations map[string]time.Duration,
+	f func(r TxReloader) error) error {
+
+	start := time.Now()
+	err := f(reloaderm[name].r)
+	durations[name] += time.Since(start)
+
+	return err
+}
+
+func reloadTx(names []string,
+	durations map[string]time.Duration) *reloadError {
+
+	for i, n := range names {
+		err := reloaderCall(n, durations, func(r TxReloader) error {
+			return r.Validate()
+		})
+
+		if err != nil {
+			rollbackReloaders(names[:i], durations)
+			return &reloadError{n, "validate", err}
+		}
+	}
+
+	for _, n := range names {
+		err := reloaderCall(n, durations, func(r TxReloader) error {
+			return r.Commit()
+		})
+
+		if err != nil {
+			rollbackReloaders(names, durations)
+			return &reloadError{n, "commit", err}
+		}
 	}
 
-	return fmt.Errorf("%s not register as a Reloader", name)
+	return nil
+}
+
+// Rollback reloaders in names in reverse order
+func rollbackReloaders(names []string, durations map[string]time.Duration) {
+	for i := len(names) - 1; i >= 0; i-- {
+		reloaderCall(names[i], durations, func(r TxReloader) error {
+			r.Rollback()
+			return nil
+		})
+	}
 }
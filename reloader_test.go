@@ -0,0 +1,253 @@
+package golib_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"golib"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testTxReloader struct {
+	name   string
+	events *events
+	fail   bool
+}
+
+func (r *testTxReloader) Validate() error {
+	r.events.add("%s.validate", r.name)
+
+	if r.fail {
+		return fmt.Errorf("validate failed")
+	}
+
+	return nil
+}
+
+func (r *testTxReloader) Commit() error {
+	r.events.add("%s.commit", r.name)
+	return nil
+}
+
+func (r *testTxReloader) Rollback() {
+	r.events.add("%s.rollback", r.name)
+}
+
+func TestTxReload(t *testing.T) {
+	e := &events{}
+	prefix := fmt.Sprintf("TestTxReload%d", time.Now().UnixNano())
+
+	a := &testTxReloader{name: "a", events: e}
+	b := &testTxReloader{name: "b", events: e, fail: true}
+
+	golib.AddTxReloader(prefix+"a", a)
+	golib.AddTxReloader(prefix+"b", b)
+	defer golib.RemoveReloader(prefix + "a")
+	defer golib.RemoveReloader(prefix + "b")
+
+	err := golib.Reload("")
+	fmt.Println(err)
+	if err == nil {
+		t.Error("reload with validate failed successd")
+	}
+
+	expect := "a.validate,b.validate,a.rollback"
+	if e.String() != expect {
+		t.Error("rollback error, expect:", expect, "get:", e.String())
+	}
+
+	e.list = nil
+	b.fail = false
+
+	if err := golib.Reload(""); err != nil {
+		t.Error("reload failed:", err)
+	}
+
+	if err := golib.Reload(prefix + "b"); err != nil {
+		t.Error("reload b failed:", err)
+	}
+
+	expect = "a.validate,b.validate,a.commit,b.commit,b.validate,b.commit"
+	if e.String() != expect {
+		t.Error("reload error, expect:", expect, "get:", e.String())
+	}
+}
+
+func TestReloaderOrder(t *testing.T) {
+	e := &events{}
+	prefix := fmt.Sprintf("TestReloaderOrder%d", time.Now().UnixNano())
+
+	a := &testTxReloader{name: "a", events: e}
+	b := &testTxReloader{name: "b", events: e}
+	c := &testTxReloader{name: "c", events: e}
+
+	golib.AddTxReloader(prefix+"a", a, prefix+"c")
+	golib.AddTxReloader(prefix+"b", b)
+	golib.AddTxReloader(prefix+"c", c)
+	golib.SetReloaderPriority(prefix+"c", 1)
+	golib.SetReloaderPriority(prefix+"b", 2)
+
+	if err := golib.AddTxReloader(prefix+"a", a); err == nil {
+		t.Error("add duplicate reloader successd")
+	}
+
+	if err := golib.RemoveReloader(prefix + "c"); err == nil {
+		t.Error("remove reloader depended by other reloader successd")
+	}
+
+	b.fail = true
+	if err := golib.Reload(""); err == nil {
+		t.Error("reload with validate failed successd")
+	}
+
+	var order []string
+	infos, _ := golib.ListReloaders()
+	for _, info := range infos {
+		if !strings.HasPrefix(info.Name, prefix) {
+			continue
+		}
+
+		order = append(order, strings.TrimPrefix(info.Name, prefix))
+		fmt.Println(info.Name, info.LastReload, info.LastError)
+
+		if info.LastReload.IsZero() || info.LastError == nil {
+			t.Error("reloader info error:", info)
+		}
+	}
+
+	if strings.Join(order, ",") != "c,a,b" {
+		t.Error("reloader order error, expect: c,a,b get:", order)
+	}
+
+	golib.ReplaceTxReloader(prefix+"b", &testTxReloader{name: "d", events: e})
+	golib.RemoveReloader(prefix + "a")
+	golib.RemoveReloader(prefix + "c")
+
+	e.list = nil
+	golib.Reload(prefix + "b")
+	golib.RemoveReloader(prefix + "b")
+
+	expect := "d.validate,d.commit"
+	if e.String() != expect {
+		t.Error("replace error, expect:", expect, "get:", e.String())
+	}
+}
+
+func TestReloaderUnknownDep(t *testing.T) {
+	e := &events{}
+	prefix := fmt.Sprintf("TestReloaderUnknownDep%d", time.Now().UnixNano())
+
+	golib.AddTxReloader(prefix+"a", &testTxReloader{name: "a", events: e})
+	golib.AddTxReloader(prefix+"bad", &testTxReloader{name: "bad", events: e},
+		prefix+"typo")
+	golib.AddTxReloader(prefix+"c", &testTxReloader{name: "c", events: e},
+		prefix+"bad")
+	defer func() {
+		for _, n := range []string{"c", "bad", "typo", "a"} {
+			golib.RemoveReloader(prefix + n)
+		}
+	}()
+
+	infos, err := golib.ListReloaders()
+	if err != nil {
+		t.Error("list reloaders failed:", err)
+	}
+
+	var order []string
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name, prefix) {
+			order = append(order, strings.TrimPrefix(info.Name, prefix))
+		}
+	}
+
+	if strings.Join(order, ",") != "a,bad,c" {
+		t.Error("reloader order error, expect: a,bad,c get:", order)
+	}
+
+	// reloaders depending on unknown reloader are skipped, others reloaded
+	report, err := golib.ReloadWithReport("")
+	fmt.Println(err)
+	if err == nil || report.Success {
+		t.Error("reload with unknown dependency successd")
+	}
+
+	if e.String() != "a.validate,a.commit" {
+		t.Error("reload error, expect: a.validate,a.commit get:", e.String())
+	}
+
+	infos, _ = golib.ListReloaders()
+	for _, info := range infos {
+		switch info.Name {
+		case prefix + "a":
+			if info.LastError != nil {
+				t.Error("reloader info error:", info)
+			}
+		case prefix + "bad", prefix + "c":
+			if info.LastError == nil {
+				t.Error("reloader info error:", info)
+			}
+		}
+	}
+
+	// dependency registered later
+	e.list = nil
+	golib.AddTxReloader(prefix+"typo", &testTxReloader{name: "typo",
+		events: e})
+
+	if err := golib.Reload(""); err != nil {
+		t.Error("reload failed:", err)
+	}
+}
+
+func TestReloadReport(t *testing.T) {
+	e := &events{}
+	name := fmt.Sprintf("TestReloadReport%d", time.Now().UnixNano())
+
+	r := &testTxReloader{name: "r", events: e, fail: true}
+	golib.AddTxReloader(name, r)
+	defer golib.RemoveReloader(name)
+
+	report, err := golib.ReloadWithReport(name)
+	if err == nil || report.Success || len(report.Reloaders) != 1 ||
+		report.Reloaders[0].Name != name || report.Reloaders[0].Success ||
+		report.Reloaders[0].Error != "validate failed" {
+
+		t.Error("reload report error:", report)
+	}
+
+	r.fail = false
+	report, err = golib.ReloadWithReport(name)
+	if err != nil || !report.Success || !report.Reloaders[0].Success {
+		t.Error("reload report error:", report)
+	}
+
+	history := golib.ReloadHistory()
+	if history[len(history)-1] != report {
+		t.Error("reload history error, expect:", report,
+			"get:", history[len(history)-1])
+	}
+
+	w := httptest.NewRecorder()
+	golib.ReloadReportHandler(w, httptest.NewRequest("GET", "/reload?n=1",
+		nil))
+	fmt.Println(w.Body.String())
+
+	var reports []*golib.ReloadReport
+	if err := json.Unmarshal(w.Body.Bytes(), &reports); err != nil ||
+		len(reports) != 1 || reports[0].ID != report.ID {
+
+		t.Error("reload report handler error:", w.Body.String())
+	}
+
+	// Reload records report in history as ReloadWithReport
+	if err := golib.Reload(name); err != nil {
+		t.Error("reload failed:", err)
+	}
+
+	history = golib.ReloadHistory()
+	if last := history[len(history)-1]; last.Name != name || !last.Success {
+		t.Error("reload history error, get:", last)
+	}
+}
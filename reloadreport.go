@@ -0,0 +1,112 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib reload report
+
+package golib
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default number of reload reports kept in history
+const reloadHistory = 32
+
+// Result of a reloader in a reload
+type ReloaderReport struct {
+	Name     string        `json:"name"`
+	Success  bool          `json:"success"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Report of a reload, reloaders are listed in reload order
+type ReloadReport struct {
+	// Sequence number of reload, start from 1
+	ID uint64 `json:"id"`
+
+	// Name of reloader, "" means all reloaders
+	Name string `json:"name"`
+
+	Time      time.Time        `json:"time"`
+	Duration  time.Duration    `json:"duration"`
+	Success   bool             `json:"success"`
+	Error     string           `json:"error,omitempty"`
+	Reloaders []ReloaderReport `json:"reloaders"`
+}
+
+var (
+	reloadReports    []*ReloadReport
+	reloadReportMax  = reloadHistory
+	reloadReportID   uint64
+	reloadReportLock sync.Mutex
+)
+
+// Set max number of reload reports kept in history, default is 32
+func SetReloadHistory(n int) {
+	reloadReportLock.Lock()
+	defer reloadReportLock.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+
+	reloadReportMax = n
+	if len(reloadReports) > n {
+		reloadReports = reloadReports[len(reloadReports)-n:]
+	}
+}
+
+// Get reload reports in history, the latest is the last
+func ReloadHistory() []*ReloadReport {
+	reloadReportLock.Lock()
+	defer reloadReportLock.Unlock()
+
+	return append([]*ReloadReport(nil), reloadReports...)
+}
+
+func addReloadReport(report *ReloadReport) {
+	reloadReportLock.Lock()
+	defer reloadReportLock.Unlock()
+
+	reloadReportID++
+	report.ID = reloadReportID
+
+	if reloadReportMax == 0 {
+		return
+	}
+
+	if len(reloadReports) >= reloadReportMax {
+		reloadReports = reloadReports[len(reloadReports)-reloadReportMax+1:]
+	}
+
+	reloadReports = append(reloadReports, report)
+}
+
+// HTTP handler for reload reports, could be used as handle of HTTPServer.
+// Response reload reports in history in json, the latest is the first.
+// Query parameter n limits the number of reports in response
+func ReloadReportHandler(w http.ResponseWriter, req *http.Request) {
+	history := ReloadHistory()
+
+	n := len(history)
+	if v := req.URL.Query().Get("n"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i >= 0 && i < n {
+			n = i
+		}
+	}
+
+	reports := make([]*ReloadReport, 0, n)
+	for i := len(history) - 1; i >= len(history)-n; i-- {
+		reports = append(reports, history[i])
+	}
+
+	body, _ := json.Marshal(reports)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
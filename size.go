@@ -49,7 +49,7 @@ func (s Size) String() string {
 	base := 0
 
 	for {
-		if len(unitBase) == base {
+		if ret == 0 || len(unitBase)-1 == base {
 			break
 		}
 
@@ -0,0 +1,64 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib toml config
+
+package golib
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Reflect toml config into struct, tags are the same as JsonConfig, key of
+// field is json tag if set, otherwise lower case of field name. Nested
+// struct is reflected from table, list of struct from array of tables
+//
+// Example:
+//
+// test.toml:
+//
+//	cstring = "Hello World"
+//	csize = "10M"
+//	cduration = "20s"
+//
+//	[tls]
+//	cert = "server.crt"
+//
+// Parse test.toml:
+//
+//	config := &Config{}
+//	err := golib.TomlConfigFile("test.toml", config)
+func TomlConfig(tml string, it interface{}, opts ...ConfigOption) error {
+	s, err := parseToml([]byte(tml))
+	if err != nil {
+		return err
+	}
+
+	return treeConfig(s, it, opts...)
+}
+
+func parseToml(tml []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(tml), &doc); err != nil {
+		return nil, fmt.Errorf("Invalid toml: %s", err.Error())
+	}
+
+	s, _ := normalizeConf(doc).(map[string]interface{})
+	if s == nil {
+		s = map[string]interface{}{}
+	}
+
+	return s, nil
+}
+
+// Load toml file in path and reflect into struct it, see TomlConfig
+func TomlConfigFile(path string, it interface{}, opts ...ConfigOption) error {
+	tml, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return TomlConfig(string(tml), it, opts...)
+}
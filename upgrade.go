@@ -0,0 +1,220 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib hot upgrade
+
+package golib
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Environment variables pass from old process to new process in upgrade
+const (
+	// addresses of inherited listeners, split by ",", fd start from 3
+	envListeners = "GOLIB_LISTENERS"
+
+	// pid of old process
+	envParent = "GOLIB_PARENT"
+)
+
+// Time waiting for Listen claiming inherited listeners after mainloop
+// started, as Listen is usually called in module mainloop
+const inheritedTimeout = 5 * time.Second
+
+// listeners opened by Listen, use address as index
+var (
+	listeners     = make(map[string]*upgradeListener)
+	inherited     map[string]net.Listener
+	inheritedOnce sync.Once
+	listenersLock sync.Mutex
+)
+
+// Listener could be passed to new process in upgrade
+type upgradeListener struct {
+	*net.TCPListener
+	addr string
+}
+
+// Close listener, and stop passing it to new process
+func (l *upgradeListener) Close() error {
+	listenersLock.Lock()
+	if listeners[l.addr] == l {
+		delete(listeners, l.addr)
+	}
+	listenersLock.Unlock()
+
+	return l.TCPListener.Close()
+}
+
+// Load listeners inherited from old process
+func loadInherited() {
+	inherited = make(map[string]net.Listener)
+
+	env := os.Getenv(envListeners)
+	if env == "" {
+		return
+	}
+	os.Unsetenv(envListeners)
+
+	for i, addr := range strings.Split(env, ",") {
+		f := os.NewFile(uintptr(3+i), addr)
+		l, err := net.FileListener(f)
+		f.Close()
+
+		if err == nil {
+			inherited[addr] = l
+		}
+	}
+}
+
+// Close inherited listeners not claimed by Listen, they are still bound but
+// never accepted on. Return addresses of listeners closed
+func closeInherited() []string {
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
+
+	inheritedOnce.Do(loadInherited)
+
+	var addrs []string
+	for addr, l := range inherited {
+		l.Close()
+		delete(inherited, addr)
+		addrs = append(addrs, addr)
+	}
+
+	return addrs
+}
+
+// Listen on tcp address addr. If process is started by upgrade and addr is
+// listened in old process, reuse the listener inherited from old process.
+// Listener will be passed to new process when upgrade until it is closed.
+// Inherited listeners not claimed in 5s after module mainloop started are
+// closed
+func Listen(addr string) (net.Listener, error) {
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
+
+	inheritedOnce.Do(loadInherited)
+
+	l, ok := inherited[addr]
+	if ok {
+		delete(inherited, addr)
+	} else {
+		var err error
+		if l, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+
+	tl, ok := l.(*net.TCPListener)
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("%s is not a tcp listener", addr)
+	}
+
+	ul := &upgradeListener{
+		TCPListener: tl,
+		addr:        addr,
+	}
+	listeners[addr] = ul
+
+	return ul, nil
+}
+
+// Start new process with same binary path and arguments,
+// listeners opened by Listen and pidfile if not nil will be passed to
+// new process
+func startUpgrade(pidfile *os.File) (*exec.Cmd, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	listenersLock.Lock()
+
+	var (
+		addrs []string
+		files []*os.File
+	)
+
+	for addr, l := range listeners {
+		f, err := l.File()
+		if err != nil {
+			listenersLock.Unlock()
+			closeFiles(files)
+			return nil, fmt.Errorf("get fd of %s failed, %s", addr, err)
+		}
+
+		addrs = append(addrs, addr)
+		files = append(files, f)
+	}
+
+	listenersLock.Unlock()
+	defer closeFiles(files)
+
+	env := []string{
+		envListeners + "=" + strings.Join(addrs, ","),
+		envParent + "=" + strconv.Itoa(os.Getpid()),
+	}
+
+	extra := files
+	if pidfile != nil {
+		env = append(env, envPidFile+"="+strconv.Itoa(3+len(files)))
+		extra = append(extra[:len(extra):len(extra)], pidfile)
+	}
+
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, envListeners+"=") ||
+			strings.HasPrefix(e, envParent+"=") ||
+			strings.HasPrefix(e, envPidFile+"=") {
+
+			continue
+		}
+
+		env = append(env, e)
+	}
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = extra
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// If process is started by upgrade, notify old process to exit gracefully,
+// return pid of old process, 0 if process is not started by upgrade
+func notifyParent() (int, error) {
+	env := os.Getenv(envParent)
+	if env == "" {
+		return 0, nil
+	}
+	os.Unsetenv(envParent)
+
+	pid, err := strconv.Atoi(env)
+	if err != nil || pid != os.Getppid() {
+		return 0, nil
+	}
+
+	return pid, syscall.Kill(pid, syscall.SIGQUIT)
+}
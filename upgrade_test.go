@@ -0,0 +1,131 @@
+package golib_test
+
+import (
+	"bytes"
+	"golib"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+const upgradeChildEnv = "GOLIB_TEST_UPGRADE_CHILD"
+
+// Run as new process in upgrade by TestUpgradeListen, inherit listeners of
+// addresses in GOLIB_LISTENERS from fd 3
+func TestUpgradeChild(t *testing.T) {
+	if os.Getenv(upgradeChildEnv) == "" {
+		t.Skip("run by TestUpgradeListen")
+	}
+
+	addrs := strings.Split(os.Getenv("GOLIB_LISTENERS"), ",")
+	if len(addrs) != 2 {
+		t.Fatal("inherited listeners error, get:", addrs)
+	}
+
+	l, err := golib.Listen(addrs[0])
+	if err != nil {
+		t.Fatal("listen inherited failed:", err)
+	}
+	defer l.Close()
+
+	if env := os.Getenv("GOLIB_LISTENERS"); env != "" {
+		t.Error("inherited listeners env not unset, get:", env)
+	}
+
+	go func() {
+		if c, err := net.Dial("tcp", addrs[0]); err == nil {
+			c.Close()
+		}
+	}()
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal("accept on inherited listener failed:", err)
+	}
+	c.Close()
+
+	// second listener is inherited but not claimed, still bound
+	if l, err := net.Listen("tcp", addrs[1]); err == nil {
+		l.Close()
+		t.Fatal("inherited listener not loaded")
+	}
+
+	ms := golib.NewModuleManager()
+	ms.SetLog(moduleLog, golib.LOGDEBUG)
+	ms.SetSignalSource(make(chan os.Signal))
+	ms.AddModule("m", newTestModule("m", &events{}))
+
+	done := startModules(t, ms)
+
+	// closed 5s after mainloop started
+	for i := 0; ; i++ {
+		if l, err := net.Listen("tcp", addrs[1]); err == nil {
+			l.Close()
+			break
+		}
+
+		if i == 100 {
+			t.Error("unclaimed inherited listener not closed")
+			break
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	ms.Stop()
+	waitModules(t, done)
+}
+
+func TestUpgradeListen(t *testing.T) {
+	var (
+		addrs []string
+		files []*os.File
+	)
+
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := l.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// socket is kept open by f, and passed to new process
+		l.Close()
+
+		addrs = append(addrs, l.Addr().String())
+		files = append(files, f)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestUpgradeChild$",
+		"-test.v")
+	cmd.Env = append(os.Environ(), upgradeChildEnv+"=1",
+		"GOLIB_LISTENERS="+strings.Join(addrs, ","))
+	cmd.ExtraFiles = files
+
+	out := &bytes.Buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	err := cmd.Start()
+
+	// only new process holds the sockets
+	for _, f := range files {
+		f.Close()
+	}
+
+	if err != nil {
+		t.Fatal("start upgrade child failed:", err)
+	}
+
+	err = cmd.Wait()
+	if err != nil || !strings.Contains(out.String(), "--- PASS") {
+		t.Error("upgrade child failed:", err, "output:", out.String())
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib config watcher
+
+package golib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Default delay between last change of config file and reload
+const watcherDelay = 100 * time.Millisecond
+
+// Events in directory which may change config file
+const watcherMask = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_CREATE
+
+// Config file watched by ConfigWatcher
+type watchedFile struct {
+	path   string
+	name   string
+	target string
+	timer  *Timer
+}
+
+// ConfigWatcher watches config files by inotify, and calls Reload for the
+// reloader associated with config file when the file is written or replaced.
+// Parent directory of config file and directory of the file it links to are
+// watched, so rename-over and symlink swap such as kubernetes configmap
+// update could be detected. Reload is delayed until no change in delay.
+//
+// Example:
+//
+//	w, err := golib.NewConfigWatcher(0, log)
+//	if err != nil {
+//		return err
+//	}
+//
+//	w.Watch("/etc/app/app.conf", "app")
+//	go w.Start()
+//	...
+//	w.Close()
+type ConfigWatcher struct {
+	fd     int
+	file   *os.File
+	delay  time.Duration
+	log    *Log
+	closed bool
+
+	files map[string]*watchedFile
+	wds   map[int]string // watch descriptor to directory
+	dirs  map[string]int // directory to watch descriptor
+	refs  map[string]int // reference count of directory
+	lock  sync.Mutex
+}
+
+// New a config watcher, delay is the time waiting for no change before
+// reload, default is 100ms. log is used to record reload error, could be nil
+func NewConfigWatcher(delay time.Duration, log *Log) (*ConfigWatcher,
+	error) {
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init failed, %s", err)
+	}
+
+	if delay <= 0 {
+		delay = watcherDelay
+	}
+
+	w := &ConfigWatcher{
+		fd:    fd,
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		delay: delay,
+		log:   log,
+		files: make(map[string]*watchedFile),
+		wds:   make(map[int]string),
+		dirs:  make(map[string]int),
+		refs:  make(map[string]int),
+	}
+
+	return w, nil
+}
+
+// Watch config file path, Reload(name) will be called when it changes
+func (w *ConfigWatcher) Watch(path string, name string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return fmt.Errorf("config watcher closed")
+	}
+
+	if _, ok := w.files[path]; ok {
+		return fmt.Errorf("%s has been watched", path)
+	}
+
+	wf := &watchedFile{
+		path:   path,
+		name:   name,
+		target: w.resolve(path),
+	}
+
+	if err := w.addDir(filepath.Dir(wf.path)); err != nil {
+		return err
+	}
+
+	if err := w.addDir(filepath.Dir(wf.target)); err != nil {
+		w.delDir(filepath.Dir(wf.path))
+		return err
+	}
+
+	w.files[path] = wf
+
+	return nil
+}
+
+// Stop watching config file path
+func (w *ConfigWatcher) Unwatch(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	wf, ok := w.files[path]
+	if !ok {
+		return fmt.Errorf("%s not watched", path)
+	}
+	delete(w.files, path)
+
+	if w.closed {
+		return nil
+	}
+
+	if wf.timer != nil {
+		wf.timer.Stop()
+	}
+
+	w.delDir(filepath.Dir(wf.path))
+	w.delDir(filepath.Dir(wf.target))
+
+	return nil
+}
+
+// Start watching, it will block until Close called. Return nil if closed
+// normally, otherwise return error
+func (w *ConfigWatcher) Start() error {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			w.lock.Lock()
+			closed := w.closed
+			w.lock.Unlock()
+
+			if closed {
+				return nil
+			}
+
+			return err
+		}
+
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			off += unix.SizeofInotifyEvent
+
+			name := ""
+			if ev.Len > 0 {
+				name = cstring(buf[off : off+int(ev.Len)])
+				off += int(ev.Len)
+			}
+
+			w.handle(int(ev.Wd), ev.Mask, name)
+		}
+	}
+}
+
+// Close config watcher, Start will return, pending reloads are canceled
+func (w *ConfigWatcher) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	for _, wf := range w.files {
+		if wf.timer != nil {
+			wf.timer.Stop()
+		}
+	}
+
+	return w.file.Close()
+}
+
+// for log
+func (w *ConfigWatcher) Prefix() string {
+	return "[watcher]"
+}
+
+// for log
+func (w *ConfigWatcher) Suffix() string {
+	return ""
+}
+
+// for log
+func (w *ConfigWatcher) LogLevel() int {
+	return LOGINFO
+}
+
+func cstring(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+
+	return string(b)
+}
+
+// Resolve symlinks in path, return path itself if it could not be resolved
+func (w *ConfigWatcher) resolve(path string) string {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+
+	return target
+}
+
+func (w *ConfigWatcher) addDir(dir string) error {
+	if w.refs[dir] > 0 {
+		w.refs[dir]++
+		return nil
+	}
+
+	wd, err := unix.InotifyAddWatch(w.fd, dir, watcherMask)
+	if err != nil {
+		return fmt.Errorf("watch %s failed, %s", dir, err)
+	}
+
+	w.wds[wd] = dir
+	w.dirs[dir] = wd
+	w.refs[dir] = 1
+
+	return nil
+}
+
+func (w *ConfigWatcher) delDir(dir string) {
+	if w.refs[dir] == 0 {
+		return
+	}
+
+	w.refs[dir]--
+	if w.refs[dir] > 0 {
+		return
+	}
+
+	wd := w.dirs[dir]
+	unix.InotifyRmWatch(w.fd, uint32(wd))
+
+	delete(w.wds, wd)
+	delete(w.dirs, dir)
+	delete(w.refs, dir)
+}
+
+// Handle inotify event, find config files may be changed and schedule reload
+func (w *ConfigWatcher) handle(wd int, mask uint32, name string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	dir, ok := w.wds[wd]
+
+	if mask&unix.IN_IGNORED != 0 { // directory removed
+		if ok {
+			delete(w.wds, wd)
+			delete(w.dirs, dir)
+			delete(w.refs, dir)
+		}
+		return
+	}
+
+	overflow := mask&unix.IN_Q_OVERFLOW != 0
+	if !ok && !overflow {
+		return
+	}
+
+	for _, wf := range w.files {
+		changed := overflow ||
+			filepath.Join(dir, name) == wf.path ||
+			filepath.Join(dir, name) == wf.target
+
+		// symlink in path may be swapped
+		target := w.resolve(wf.path)
+		if target != wf.target {
+			w.delDir(filepath.Dir(wf.target))
+			if err := w.addDir(filepath.Dir(target)); err != nil &&
+				w.log != nil {
+
+				w.log.LogError(w, "%s", err.Error())
+			}
+
+			wf.target = target
+			changed = true
+		}
+
+		if changed {
+			w.schedule(wf)
+		}
+	}
+}
+
+// Schedule reload of config file, restart delay if reload is pending
+func (w *ConfigWatcher) schedule(wf *watchedFile) {
+	if wf.timer != nil {
+		wf.timer.Stop()
+	}
+
+	wf.timer = NewTimer(w.delay, w.reload, wf)
+}
+
+func (w *ConfigWatcher) reload(d interface{}) {
+	wf := d.(*watchedFile)
+
+	err := Reload(wf.name)
+	if w.log == nil {
+		return
+	}
+
+	if err != nil {
+		w.log.LogError(w, "reload %s for %s failed, %s",
+			wf.name, wf.path, err.Error())
+	} else {
+		w.log.LogInfo(w, "reload %s for %s", wf.name, wf.path)
+	}
+}
@@ -0,0 +1,93 @@
+package golib_test
+
+import (
+	"fmt"
+	"golib"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Wait until n reloads recorded in e
+func waitReload(t *testing.T, e *events, n int) {
+	for i := 0; strings.Count(e.String(), "reload") < n; i++ {
+		if i == 100 {
+			t.Fatal("reload not called, expect:", n, "get:", e.String())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConfigWatcher(t *testing.T) {
+	e := &events{}
+	name := fmt.Sprintf("TestConfigWatcher%d", time.Now().UnixNano())
+	golib.AddReloader(name, &testReloader{events: e})
+	defer golib.RemoveReloader(name)
+
+	dir, err := ioutil.TempDir("", "golib_watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// kubernetes configmap layout: app.conf -> ..data/app.conf, ..data -> v1
+	os.Mkdir(filepath.Join(dir, "v1"), 0755)
+	os.Mkdir(filepath.Join(dir, "v2"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "v1", "app.conf"), []byte("v1"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "v2", "app.conf"), []byte("v2"), 0644)
+	os.Symlink("v1", filepath.Join(dir, "..data"))
+	os.Symlink(filepath.Join("..data", "app.conf"),
+		filepath.Join(dir, "app.conf"))
+
+	ioutil.WriteFile(filepath.Join(dir, "other.conf"), []byte("1"), 0644)
+
+	w, err := golib.NewConfigWatcher(10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- w.Start()
+	}()
+
+	if err := w.Watch(filepath.Join(dir, "app.conf"), name); err != nil {
+		t.Fatal(err)
+	}
+
+	other := filepath.Join(dir, "other.conf")
+	if err := w.Watch(other, name); err != nil {
+		t.Fatal(err)
+	}
+
+	// write
+	ioutil.WriteFile(other, []byte("2"), 0644)
+	waitReload(t, e, 1)
+
+	// rename over
+	ioutil.WriteFile(other+".tmp", []byte("3"), 0644)
+	os.Rename(other+".tmp", other)
+	waitReload(t, e, 2)
+
+	// symlink swap
+	os.Symlink("v2", filepath.Join(dir, "..data_tmp"))
+	os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data"))
+	waitReload(t, e, 3)
+
+	// write to linked file
+	ioutil.WriteFile(filepath.Join(dir, "v2", "app.conf"), []byte("4"), 0644)
+	waitReload(t, e, 4)
+
+	if err := w.Unwatch(other); err != nil {
+		t.Error("unwatch failed:", err)
+	}
+
+	w.Close()
+	if err := <-done; err != nil {
+		t.Error("watcher exit error:", err)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib config watcher
+
+//go:build !linux
+// +build !linux
+
+package golib
+
+import (
+	"fmt"
+	"time"
+)
+
+// ConfigWatcher is only supported on linux
+type ConfigWatcher struct {
+}
+
+// New a config watcher, always return error as inotify is not supported
+func NewConfigWatcher(delay time.Duration, log *Log) (*ConfigWatcher,
+	error) {
+
+	return nil, fmt.Errorf("config watcher not supported")
+}
+
+// Watch config file path, Reload(name) will be called when it changes
+func (w *ConfigWatcher) Watch(path string, name string) error {
+	return fmt.Errorf("config watcher not supported")
+}
+
+// Stop watching config file path
+func (w *ConfigWatcher) Unwatch(path string) error {
+	return fmt.Errorf("config watcher not supported")
+}
+
+// Start watching, it will block until Close called
+func (w *ConfigWatcher) Start() error {
+	return fmt.Errorf("config watcher not supported")
+}
+
+// Close config watcher
+func (w *ConfigWatcher) Close() error {
+	return nil
+}
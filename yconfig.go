@@ -0,0 +1,66 @@
+// Copyright (C) AlexWoo(Wu Jie) wj19840501@gmail.com
+//
+// golib yaml config
+
+package golib
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Reflect yaml config into struct, tags are the same as JsonConfig, key of
+// field is json tag if set, otherwise lower case of field name
+//
+// Example:
+//
+// test.yaml:
+//
+//	cstring: Hello World
+//	csize: 10M
+//	cduration: 20s
+//	tls:
+//	  cert: server.crt
+//
+// Parse test.yaml:
+//
+//	config := &Config{}
+//	err := golib.YamlConfigFile("test.yaml", config)
+func YamlConfig(yml string, it interface{}, opts ...ConfigOption) error {
+	s, err := parseYaml([]byte(yml))
+	if err != nil {
+		return err
+	}
+
+	return treeConfig(s, it, opts...)
+}
+
+func parseYaml(yml []byte) (map[string]interface{}, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(yml, &doc); err != nil {
+		return nil, fmt.Errorf("Invalid yaml: %s", err.Error())
+	}
+
+	if doc == nil { // empty document
+		return map[string]interface{}{}, nil
+	}
+
+	s, ok := normalizeConf(doc).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a yaml map: %s", string(yml))
+	}
+
+	return s, nil
+}
+
+// Load yaml file in path and reflect into struct it, see YamlConfig
+func YamlConfigFile(path string, it interface{}, opts ...ConfigOption) error {
+	yml, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return YamlConfig(string(yml), it, opts...)
+}